@@ -0,0 +1,94 @@
+// Package availability reads the reviewer out-of-office calendar.
+//
+// The calendar is a YAML file mapping logins to date ranges during which
+// they should not be asked to review:
+//
+//	quinqu:
+//	  - from: 2021-12-20
+//	    to: 2022-01-03
+//
+// Both ends of a range are inclusive and interpreted in UTC.
+package availability
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const dateFormat = "2006-01-02"
+
+// Calendar holds the out-of-office ranges of each reviewer.
+type Calendar struct {
+	away map[string][]Range
+}
+
+// Range is an inclusive range of days.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+type rangeSpec struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// Load reads the calendar file at path.
+func Load(path string) (*Calendar, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse decodes a calendar.
+func Parse(data []byte) (*Calendar, error) {
+	var specs map[string][]rangeSpec
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	c := &Calendar{away: map[string][]Range{}}
+	for login, ranges := range specs {
+		for _, spec := range ranges {
+			from, err := time.Parse(dateFormat, spec.From)
+			if err != nil {
+				return nil, fmt.Errorf("%v: bad from date: %w", login, err)
+			}
+			to := from
+			if spec.To != "" {
+				if to, err = time.Parse(dateFormat, spec.To); err != nil {
+					return nil, fmt.Errorf("%v: bad to date: %w", login, err)
+				}
+			}
+			if to.Before(from) {
+				return nil, fmt.Errorf("%v: range %v to %v ends before it starts", login, spec.From, spec.To)
+			}
+			key := strings.ToLower(login)
+			c.away[key] = append(c.away[key], Range{From: from, To: to})
+		}
+	}
+	return c, nil
+}
+
+// Away reports whether login is out of office at t.
+func (c *Calendar) Away(login string, t time.Time) bool {
+	if c == nil {
+		return false
+	}
+	day := t.UTC().Truncate(24 * time.Hour)
+	for _, r := range c.away[strings.ToLower(login)] {
+		if !day.Before(r.From) && !day.After(r.To) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+)
+
+// Assign requests reviews from every pool responsible for the files the
+// pull request changes and, if enabled, from their code owners, then
+// updates the status comment.
+func (b *Bot) Assign(ctx context.Context) error {
+	if err := b.requirePullRequest(); err != nil {
+		return err
+	}
+	files, err := b.listFiles(ctx)
+	if err != nil {
+		return err
+	}
+	areas, err := b.ownedAreas(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	// Reviewers already requested or who already reviewed are skipped, so
+	// that handling an event twice does not re-request their review.
+	involved, err := b.involvedReviewers(ctx)
+	if err != nil {
+		return err
+	}
+
+	env := b.c.Environment
+	var req github.ReviewersRequest
+	seen := map[string]bool{}
+	add := func(reviewer string) {
+		if reviewer == "" || seen[strings.ToLower(reviewer)] {
+			return
+		}
+		seen[strings.ToLower(reviewer)] = true
+		if org, slug, ok := config.ParseTeam(reviewer); ok {
+			// Only teams of the repository's organization can be requested.
+			if !strings.EqualFold(org, env.Organization) {
+				log.Printf("Unable to request team %v outside %v.", reviewer, env.Organization)
+				return
+			}
+			req.TeamReviewers = append(req.TeamReviewers, slug)
+			return
+		}
+		if involved[strings.ToLower(reviewer)] {
+			return
+		}
+		req.Reviewers = append(req.Reviewers, reviewer)
+	}
+	pools, err := b.pools(ctx, files)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		reviewers, err := b.poolReviewers(ctx, p)
+		if err != nil {
+			return err
+		}
+		for _, r := range reviewers {
+			add(r)
+		}
+	}
+	for _, area := range areas {
+		for _, owner := range area.Owners {
+			add(b.resolveOwner(ctx, owner))
+		}
+	}
+	if len(req.Reviewers) == 0 && len(req.TeamReviewers) == 0 {
+		log.Printf("No new reviewers to assign to #%v.", env.Number)
+	} else {
+		log.Printf("Requesting reviews on #%v from %v.", env.Number,
+			strings.Join(append(append([]string{}, req.Reviewers...), req.TeamReviewers...), ", "))
+		_, _, err = b.c.GitHub.PullRequests.RequestReviewers(ctx, env.Organization, env.Repository, env.Number, req)
+		if err != nil {
+			return err
+		}
+		b.pr = nil
+	}
+
+	g, err := b.evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	return b.updateStatusComment(ctx, g)
+}
@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/graphql"
+)
+
+// staffing describes who can review for a pool right now.
+type staffing struct {
+	// Candidates are the pool's reviewers, excluding the author.
+	Candidates []string
+	// Available are the candidates who are not out of office.
+	Available []string
+	// Substitutes are available reviewers from the defaults pool standing
+	// in for absent candidates.
+	Substitutes []string
+	// Required is the number of approvals the pool needs.
+	Required int
+}
+
+// absent returns the number of required approvals the available
+// candidates cannot cover on their own.
+func (s staffing) absent() int {
+	if n := s.Required - len(s.Available); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// staff works out who reviews for pool p, substituting absent candidates
+// with available reviewers from the defaults pool.
+func (b *Bot) staff(ctx context.Context, p config.Pool) (staffing, error) {
+	candidates, err := b.candidates(ctx, p)
+	if err != nil {
+		return staffing{}, err
+	}
+	required, err := b.required(ctx, p)
+	if err != nil {
+		return staffing{}, err
+	}
+	s := staffing{
+		Candidates: candidates,
+		Required:   required,
+	}
+	inPool := map[string]bool{}
+	for _, c := range s.Candidates {
+		inPool[strings.ToLower(c)] = true
+		if b.available(ctx, c) {
+			s.Available = append(s.Available, c)
+		}
+	}
+	if s.absent() == 0 {
+		return s, nil
+	}
+	defaults, err := b.expand(ctx, b.c.Reviewers.Defaults.Reviewers)
+	if err != nil {
+		return staffing{}, err
+	}
+	var pool []string
+	for _, c := range defaults {
+		if !inPool[strings.ToLower(c)] && b.available(ctx, c) {
+			pool = append(pool, c)
+		}
+	}
+	substitutes, err := b.selectReviewers(ctx, pool, s.absent())
+	if err != nil {
+		return staffing{}, err
+	}
+	s.Substitutes = substitutes
+	if len(substitutes) != 0 {
+		log.Printf("Pool %q: %v substituting for unavailable reviewers.", p.Name, strings.Join(substitutes, ", "))
+	}
+	return s, nil
+}
+
+// available reports whether login can be asked to review. Reviewers are
+// unavailable while out of office in the calendar or, if enabled, while
+// their GitHub status is set to busy.
+func (b *Bot) available(ctx context.Context, login string) bool {
+	key := strings.ToLower(login)
+	if ok, cached := b.availability[key]; cached {
+		return ok
+	}
+	ok := true
+	switch {
+	case b.c.Calendar.Away(login, time.Now()):
+		log.Printf("%v is out of office.", login)
+		ok = false
+	case b.c.Reviewers.Availability.GitHubStatus:
+		busy, err := b.githubBusy(ctx, login)
+		if err != nil {
+			// Prefer asking a busy reviewer over failing assignment.
+			log.Printf("Unable to read GitHub status of %v: %v.", login, err)
+		} else if busy {
+			log.Printf("%v has set their GitHub status to busy.", login)
+			ok = false
+		}
+	}
+	b.availability[key] = ok
+	return ok
+}
+
+// githubBusy reports whether the GitHub status of login indicates limited
+// availability. The status is only exposed through the GraphQL API.
+func (b *Bot) githubBusy(ctx context.Context, login string) (bool, error) {
+	var data struct {
+		User *struct {
+			Status *struct {
+				IndicatesLimitedAvailability bool `json:"indicatesLimitedAvailability"`
+			} `json:"status"`
+		} `json:"user"`
+	}
+	err := graphql.New(b.c.GitHub).Query(ctx,
+		`query($login: String!) { user(login: $login) { status { indicatesLimitedAvailability } } }`,
+		map[string]interface{}{"login": login}, &data)
+	if err != nil {
+		return false, err
+	}
+	return data.User != nil && data.User.Status != nil && data.User.Status.IndicatesLimitedAvailability, nil
+}
@@ -0,0 +1,231 @@
+// Package bot implements the review bot subcommands.
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/availability"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/environment"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/graphql"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/verify"
+)
+
+// Config holds the dependencies of the bot.
+type Config struct {
+	// GitHub is the API client.
+	GitHub *github.Client
+	// Environment is the event being handled.
+	Environment *environment.Environment
+	// Reviewers is the review policy.
+	Reviewers *config.Config
+	// Calendar is the reviewer out-of-office calendar, if any.
+	Calendar *availability.Calendar
+	// GraphQL fetches the files, commits, reviews and review requests of
+	// the pull request in batched GraphQL queries rather than through the
+	// REST API.
+	GraphQL bool
+	// KeepDefaultBranch stops dismiss-runs from cancelling runs on the
+	// repository's default branch, so that every commit merged is built.
+	KeepDefaultBranch bool
+	// IsWebFlow reports whether a commit was created by GitHub itself, e.g.
+	// by "Update branch". Defaults to verify.IsWebFlow, which checks the
+	// signature with gpg.
+	IsWebFlow func(commit *github.RepositoryCommit) bool
+}
+
+// CheckAndSetDefaults verifies the configuration.
+func (c *Config) CheckAndSetDefaults() error {
+	if c.GitHub == nil {
+		return fmt.Errorf("missing GitHub client")
+	}
+	if c.Environment == nil {
+		return fmt.Errorf("missing environment")
+	}
+	if c.IsWebFlow == nil {
+		c.IsWebFlow = verify.IsWebFlow
+	}
+	return nil
+}
+
+// Bot performs review bot actions against a single repository.
+type Bot struct {
+	c Config
+	// emails caches CODEOWNERS email owners resolved to logins.
+	emails map[string]string
+	// loads caches the open review request count per lowercased login.
+	loads map[string]int
+	// involved caches the reviewers requested on or who reviewed the pull
+	// request.
+	involved map[string]bool
+	// availability caches whether each lowercased login can review.
+	availability map[string]bool
+	// teams caches team members by lowercased "org/slug".
+	teams map[string][]string
+	// class caches the contributor class of the author.
+	class string
+	// pr caches the pull request fetched through GraphQL. It is reset
+	// whenever the bot changes the reviews or review requests.
+	pr *graphql.PullRequest
+}
+
+// New returns a bot.
+func New(c Config) (*Bot, error) {
+	if err := c.CheckAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	return &Bot{
+		c:            c,
+		emails:       map[string]string{},
+		loads:        map[string]int{},
+		availability: map[string]bool{},
+		teams:        map[string][]string{},
+	}, nil
+}
+
+// requirePullRequest fails for events that do not reference a pull request.
+func (b *Bot) requirePullRequest() error {
+	env := b.c.Environment
+	if env.Number == 0 {
+		return fmt.Errorf("event %q does not reference a pull request", env.EventName)
+	}
+	if b.c.Reviewers == nil {
+		return fmt.Errorf("missing reviewer configuration")
+	}
+	return nil
+}
+
+// fetch returns the pull request fetched through GraphQL.
+func (b *Bot) fetch(ctx context.Context) (*graphql.PullRequest, error) {
+	if b.pr != nil {
+		return b.pr, nil
+	}
+	env := b.c.Environment
+	pr, err := graphql.New(b.c.GitHub).FetchPullRequest(ctx, env.Organization, env.Repository, env.Number)
+	if err != nil {
+		return nil, err
+	}
+	b.pr = pr
+	return pr, nil
+}
+
+// listFiles returns the paths of the files changed by the pull request.
+func (b *Bot) listFiles(ctx context.Context) ([]string, error) {
+	if b.c.GraphQL {
+		pr, err := b.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pr.Files, nil
+	}
+	env := b.c.Environment
+	var files []string
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := b.c.GitHub.PullRequests.ListFiles(ctx, env.Organization, env.Repository, env.Number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range page {
+			files = append(files, f.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listReviews returns all reviews submitted on the pull request, oldest
+// first.
+func (b *Bot) listReviews(ctx context.Context) ([]*github.PullRequestReview, error) {
+	if b.c.GraphQL {
+		pr, err := b.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pr.Reviews, nil
+	}
+	env := b.c.Environment
+	var reviews []*github.PullRequestReview
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := b.c.GitHub.PullRequests.ListReviews(ctx, env.Organization, env.Repository, env.Number, opts)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, page...)
+		if resp.NextPage == 0 {
+			return reviews, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listReviewers returns the pending review requests of the pull request.
+func (b *Bot) listReviewers(ctx context.Context) (*github.Reviewers, error) {
+	if b.c.GraphQL {
+		pr, err := b.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pr.Requested, nil
+	}
+	env := b.c.Environment
+	requested, _, err := b.c.GitHub.PullRequests.ListReviewers(ctx, env.Organization, env.Repository, env.Number, nil)
+	return requested, err
+}
+
+// pools returns the reviewer pools responsible for the changed files.
+func (b *Bot) pools(ctx context.Context, files []string) ([]config.Pool, error) {
+	author, err := b.author(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.c.Reviewers.Match(author, files), nil
+}
+
+// candidates returns the individual reviewers of pool p for the current
+// author, with teams expanded to their members. It falls back to the
+// defaults pool when the author is the only member.
+func (b *Bot) candidates(ctx context.Context, p config.Pool) ([]string, error) {
+	c, err := b.expand(ctx, p.Reviewers)
+	if err != nil || len(c) != 0 {
+		return c, err
+	}
+	return b.expand(ctx, b.c.Reviewers.Defaults.Reviewers)
+}
+
+// required returns the number of approvals pool p needs from the current
+// author's contributor class, capped at the number of candidates available.
+func (b *Bot) required(ctx context.Context, p config.Pool) (int, error) {
+	c, err := b.candidates(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	class, err := b.classify(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := b.c.Reviewers.Approvals(p, class)
+	if n > len(c) {
+		n = len(c)
+	}
+	return n, nil
+}
+
+// latestReviews returns the most recent decisive review state per
+// reviewer. Comments do not replace an earlier approval or rejection.
+func latestReviews(reviews []*github.PullRequestReview) map[string]*github.PullRequestReview {
+	latest := map[string]*github.PullRequestReview{}
+	for _, r := range reviews {
+		if r.GetState() == "COMMENTED" || r.GetState() == "PENDING" {
+			continue
+		}
+		latest[strings.ToLower(r.GetUser().GetLogin())] = r
+	}
+	return latest
+}
@@ -0,0 +1,694 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/availability"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/client"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/environment"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/githubtest"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/verify"
+)
+
+const (
+	testOwner = "gravitational"
+	testRepo  = "teleport"
+)
+
+// testConfig requires one approval from alice or bob, and two from
+// external contributors.
+const testConfig = `
+defaults:
+  reviewers: [alice, bob]
+contributors:
+  external:
+    approvals: 2
+`
+
+// classConfig requires one approval from alice, bob or dave, two from
+// external contributors and three from first-time contributors.
+const classConfig = `
+defaults:
+  reviewers: [alice, bob, dave]
+contributors:
+  external:
+    approvals: 2
+  first-time:
+    approvals: 3
+`
+
+// balancedPool is a load balanced pool of three reviewers for every file,
+// requiring two approvals.
+const balancedPool = `
+pools:
+  - name: everything
+    paths: ["**"]
+    reviewers: [alice, bob, dave]
+    approvals: 2
+    load_balance: true
+`
+
+// teamPool is a pool of the core team for every file.
+const teamPool = `
+pools:
+  - name: core
+    paths: ["**"]
+    reviewers: ["@gravitational/core"]
+`
+
+// newTestServer starts a fake where carol is a member of the organization
+// and every other author is external.
+func newTestServer(t *testing.T) *githubtest.Server {
+	srv := githubtest.NewServer(testOwner, testRepo)
+	t.Cleanup(srv.Close)
+	for _, login := range []string{"alice", "bob", "carol"} {
+		srv.AddMember(login)
+	}
+	return srv
+}
+
+// newTestBot returns a bot handling a pull request event for a pull
+// request of srv, with the reviewer configuration in yaml.
+func newTestBot(t *testing.T, srv *githubtest.Server, event, action string, number int, yaml string) *Bot {
+	var payload []byte
+	var err error
+	if event == "pull_request_review" {
+		payload, err = srv.PullRequestReviewEvent(action, number)
+	} else {
+		payload, err = srv.PullRequestEvent(action, number)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := environment.Parse(event, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newEventBot(t, srv, env, yaml)
+}
+
+// newEventBot returns a bot handling env against srv.
+func newEventBot(t *testing.T, srv *githubtest.Server, env *environment.Environment, yaml string) *Bot {
+	gh, err := client.New(client.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Config{GitHub: gh, Environment: env, IsWebFlow: isWebFlow}
+	if yaml != "" {
+		reviewers, err := config.Parse([]byte(yaml))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Reviewers = reviewers
+	}
+	b, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// isWebFlow stands in for verify.IsWebFlow, trusting the verification the
+// fake reports since there is no web-flow key to check signatures with.
+func isWebFlow(c *github.RepositoryCommit) bool {
+	return c.GetCommitter().GetLogin() == verify.WebFlowLogin && c.GetCommit().GetVerification().GetVerified()
+}
+
+// statusComments returns the bot's status comments on a pull request.
+func statusComments(srv *githubtest.Server, number int) []githubtest.Comment {
+	var comments []githubtest.Comment
+	for _, c := range srv.Comments(number) {
+		if c.User == githubtest.BotLogin && strings.HasPrefix(c.Body, statusMarker) {
+			comments = append(comments, c)
+		}
+	}
+	return comments
+}
+
+func TestDismissStaleApprovals(t *testing.T) {
+	tests := []struct {
+		desc   string
+		author string
+		fork   string
+		// commented is the number of comments bob leaves before the
+		// approvals, pushing them past the first page of reviews.
+		commented int
+		// approvers approve the first commit before the second is pushed.
+		approvers []string
+		committer string
+		// verified is whether GitHub verified the second commit's
+		// signature.
+		verified  bool
+		dismissed []string
+	}{
+		{
+			desc:      "external contributor pushes after approval",
+			author:    "eve",
+			fork:      "eve",
+			approvers: []string{"alice", "bob"},
+			committer: "eve",
+			dismissed: []string{"alice", "bob"},
+		},
+		{
+			desc:      "internal contributor pushes after approval",
+			author:    "carol",
+			approvers: []string{"alice"},
+			committer: "carol",
+		},
+		{
+			desc:   "external contributor without approvals",
+			author: "eve",
+			fork:   "eve",
+		},
+		{
+			desc:      "branch updated through GitHub after approval",
+			author:    "eve",
+			fork:      "eve",
+			approvers: []string{"alice", "bob"},
+			committer: verify.WebFlowLogin,
+			verified:  true,
+		},
+		{
+			desc:      "unverified web-flow commit after approval",
+			author:    "eve",
+			fork:      "eve",
+			approvers: []string{"alice", "bob"},
+			committer: verify.WebFlowLogin,
+			dismissed: []string{"alice", "bob"},
+		},
+		{
+			desc:      "approvals past the first page of reviews",
+			author:    "eve",
+			fork:      "eve",
+			commented: 150,
+			approvers: []string{"alice", "bob"},
+			committer: "eve",
+			dismissed: []string{"alice", "bob"},
+		},
+	}
+	for _, tt := range tests {
+		for _, api := range []string{"rest", "graphql"} {
+			t.Run(tt.desc+"/"+api, func(t *testing.T) {
+				srv := newTestServer(t)
+				srv.AddPullRequest(githubtest.PullRequest{
+					Number:  1,
+					Author:  tt.author,
+					Fork:    tt.fork,
+					Files:   []string{"lib/auth.go"},
+					Commits: []githubtest.Commit{{SHA: "aaa111", Committer: tt.author}},
+				})
+				for i := 0; i < tt.commented; i++ {
+					srv.Submit(1, "bob", "COMMENTED")
+				}
+				for _, login := range tt.approvers {
+					srv.Submit(1, login, "APPROVED")
+				}
+				srv.Push(1, githubtest.Commit{SHA: "bbb222", Committer: tt.committer, Verified: tt.verified})
+
+				b := newTestBot(t, srv, "pull_request_target", "synchronize", 1, testConfig)
+				b.c.GraphQL = api == "graphql"
+				if err := b.DismissStaleApprovals(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				var dismissed []string
+				for _, r := range srv.PullRequest(1).Reviews {
+					if r.State == "DISMISSED" {
+						dismissed = append(dismissed, r.User)
+					}
+				}
+				if !equal(dismissed, tt.dismissed) {
+					t.Errorf("dismissed %v, want %v", dismissed, tt.dismissed)
+				}
+			})
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		desc   string
+		author string
+		// association is the author's association GitHub reports, if not
+		// CONTRIBUTOR.
+		association string
+		// writers are users outside the organization with write access.
+		writers []string
+		fork    string
+		action  string
+		// yaml is the reviewer configuration, testConfig if empty.
+		yaml string
+		// teams maps team slugs to their members.
+		teams map[string][]string
+		// commented is the number of comments bob leaves before the
+		// approvals, pushing them past the first page of reviews.
+		commented int
+		approvers []string
+		// pushed is pushed after the approvals, if set.
+		pushed string
+		// comments are status comments already on the pull request.
+		comments int
+		// dryRun handles the event without changing anything.
+		dryRun     bool
+		conclusion string
+		dismissed  int
+	}{
+		{
+			desc:       "internal contributor approved",
+			author:     "carol",
+			action:     "opened",
+			approvers:  []string{"alice"},
+			conclusion: "success",
+		},
+		{
+			desc:       "internal contributor without approvals",
+			author:     "carol",
+			action:     "opened",
+			conclusion: "failure",
+		},
+		{
+			desc:       "external contributor with one of two approvals",
+			author:     "eve",
+			fork:       "eve",
+			action:     "opened",
+			approvers:  []string{"alice"},
+			conclusion: "failure",
+		},
+		{
+			desc:       "external contributor approved",
+			author:     "eve",
+			fork:       "eve",
+			action:     "opened",
+			approvers:  []string{"alice", "bob"},
+			conclusion: "success",
+		},
+		{
+			desc:       "external contributor pushes after approval",
+			author:     "eve",
+			fork:       "eve",
+			action:     "synchronize",
+			approvers:  []string{"alice", "bob"},
+			pushed:     "bbb222",
+			conclusion: "failure",
+			dismissed:  2,
+		},
+		{
+			desc:       "internal contributor pushes after approval",
+			author:     "carol",
+			action:     "synchronize",
+			approvers:  []string{"alice"},
+			pushed:     "bbb222",
+			conclusion: "success",
+		},
+		{
+			desc:       "duplicate status comments",
+			author:     "carol",
+			action:     "opened",
+			approvers:  []string{"alice"},
+			comments:   3,
+			conclusion: "success",
+		},
+		{
+			desc:        "first-time contributor with two of three approvals",
+			author:      "eve",
+			association: "FIRST_TIME_CONTRIBUTOR",
+			fork:        "eve",
+			action:      "opened",
+			yaml:        classConfig,
+			approvers:   []string{"alice", "bob"},
+			conclusion:  "failure",
+		},
+		{
+			desc:        "first-time contributor approved",
+			author:      "eve",
+			association: "FIRST_TIME_CONTRIBUTOR",
+			fork:        "eve",
+			action:      "opened",
+			yaml:        classConfig,
+			approvers:   []string{"alice", "bob", "dave"},
+			conclusion:  "success",
+		},
+		{
+			desc:       "external contributor needs fewer approvals than a first-time one",
+			author:     "eve",
+			fork:       "eve",
+			action:     "opened",
+			yaml:       classConfig,
+			approvers:  []string{"alice", "bob"},
+			conclusion: "success",
+		},
+		{
+			desc:       "collaborator with write access is internal",
+			author:     "frank",
+			writers:    []string{"frank"},
+			action:     "opened",
+			yaml:       classConfig,
+			approvers:  []string{"alice"},
+			conclusion: "success",
+		},
+		{
+			desc:       "member pushing from someone else's fork is external",
+			author:     "carol",
+			fork:       "eve",
+			action:     "opened",
+			yaml:       classConfig,
+			approvers:  []string{"alice"},
+			conclusion: "failure",
+		},
+		{
+			desc:       "bot",
+			author:     "dependabot[bot]",
+			fork:       "dependabot[bot]",
+			action:     "opened",
+			yaml:       classConfig,
+			approvers:  []string{"alice"},
+			conclusion: "success",
+		},
+		{
+			desc:       "approval by a team member",
+			author:     "carol",
+			action:     "opened",
+			yaml:       testConfig + teamPool,
+			teams:      map[string][]string{"core": {"dave", "erin"}},
+			approvers:  []string{"erin"},
+			conclusion: "success",
+		},
+		{
+			desc:       "approval by someone outside the team",
+			author:     "carol",
+			action:     "opened",
+			yaml:       testConfig + teamPool,
+			teams:      map[string][]string{"core": {"dave", "erin"}},
+			approvers:  []string{"alice"},
+			conclusion: "failure",
+		},
+		{
+			desc:       "approval past the first page of reviews",
+			author:     "carol",
+			action:     "opened",
+			commented:  150,
+			approvers:  []string{"alice"},
+			conclusion: "success",
+		},
+		{
+			desc:      "dry run",
+			author:    "carol",
+			action:    "opened",
+			approvers: []string{"alice"},
+			dryRun:    true,
+		},
+	}
+	for _, tt := range tests {
+		for _, api := range []string{"rest", "graphql"} {
+			t.Run(tt.desc+"/"+api, func(t *testing.T) {
+				srv := newTestServer(t)
+				for slug, members := range tt.teams {
+					srv.AddTeam(slug, members...)
+				}
+				for _, login := range tt.writers {
+					srv.SetPermission(login, "write")
+				}
+				srv.AddPullRequest(githubtest.PullRequest{
+					Number:            1,
+					Author:            tt.author,
+					AuthorAssociation: tt.association,
+					Fork:              tt.fork,
+					Files:             []string{"lib/auth.go"},
+					Commits:           []githubtest.Commit{{SHA: "aaa111", Committer: tt.author, Verified: true}},
+				})
+				for i := 0; i < tt.commented; i++ {
+					srv.Submit(1, "bob", "COMMENTED")
+				}
+				for _, login := range tt.approvers {
+					srv.Submit(1, login, "APPROVED")
+				}
+				if tt.pushed != "" {
+					srv.Push(1, githubtest.Commit{SHA: tt.pushed, Committer: tt.author, Verified: true})
+				}
+				for i := 0; i < tt.comments; i++ {
+					srv.AddComment(1, githubtest.BotLogin, statusMarker+"\nstale")
+				}
+
+				// Handling the event twice must not duplicate the check run or
+				// the status comment.
+				yaml := tt.yaml
+				if yaml == "" {
+					yaml = testConfig
+				}
+				plan := &client.Plan{}
+				for i := 0; i < 2; i++ {
+					b := newTestBot(t, srv, "pull_request_target", tt.action, 1, yaml)
+					b.c.GraphQL = api == "graphql"
+					if tt.dryRun {
+						gh, err := client.New(client.Config{BaseURL: srv.URL, DryRun: true, Plan: plan})
+						if err != nil {
+							t.Fatal(err)
+						}
+						b.c.GitHub = gh
+					}
+					if err := b.Check(context.Background()); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if tt.dryRun {
+					var ops []string
+					for _, s := range plan.Steps {
+						ops = append(ops, s.Operation)
+					}
+					want := []string{"create_check_run", "create_comment", "create_check_run", "create_comment"}
+					if strings.Join(ops, ",") != strings.Join(want, ",") {
+						t.Errorf("planned %v, want %v", ops, want)
+					}
+					if runs := srv.CheckRuns(); len(runs) != 0 {
+						t.Errorf("got %v check runs in a dry run, want none", len(runs))
+					}
+					if comments := statusComments(srv, 1); len(comments) != 0 {
+						t.Errorf("got %v status comments in a dry run, want none", len(comments))
+					}
+					return
+				}
+
+				pr := srv.PullRequest(1)
+				dismissed := 0
+				for _, r := range pr.Reviews {
+					if r.State == "DISMISSED" {
+						dismissed++
+					}
+				}
+				if dismissed != tt.dismissed {
+					t.Errorf("dismissed %v reviews, want %v", dismissed, tt.dismissed)
+				}
+				var runs []githubtest.CheckRun
+				for _, run := range srv.CheckRuns() {
+					if run.Name == CheckRunName {
+						runs = append(runs, run)
+					}
+				}
+				if len(runs) != 1 {
+					t.Fatalf("got %v check runs, want 1", len(runs))
+				}
+				if runs[0].HeadSHA != pr.HeadSHA() || runs[0].Conclusion != tt.conclusion {
+					t.Errorf("check run on %v concluded %q, want %q on %v", runs[0].HeadSHA, runs[0].Conclusion, tt.conclusion, pr.HeadSHA())
+				}
+				if comments := statusComments(srv, 1); len(comments) != 1 {
+					t.Errorf("got %v status comments, want 1", len(comments))
+				}
+			})
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	tests := []struct {
+		desc   string
+		author string
+		yaml   string
+		// codeOwners is the content of CODEOWNERS, if any.
+		codeOwners string
+		// requested are reviewers already requested.
+		requested []string
+		// reviewers are reviewers who already reviewed.
+		reviewers []string
+		// load is the number of other pull requests each user is requested
+		// to review.
+		load map[string]int
+		// away are out of office in the calendar and busy set their GitHub
+		// status to busy.
+		away []string
+		busy []string
+		// teams maps team slugs to their members.
+		teams     map[string][]string
+		want      []string
+		wantTeams []string
+	}{
+		{
+			desc:   "defaults",
+			author: "carol",
+			yaml:   testConfig,
+			want:   []string{"alice", "bob"},
+		},
+		{
+			desc:   "author is not requested",
+			author: "alice",
+			yaml:   testConfig,
+			want:   []string{"bob"},
+		},
+		{
+			desc:      "reviewers already involved are not requested again",
+			author:    "carol",
+			yaml:      testConfig,
+			requested: []string{"alice"},
+			reviewers: []string{"bob"},
+			want:      []string{"alice"},
+		},
+		{
+			desc:   "code owners",
+			author: "carol",
+			yaml:   testConfig + "codeowners: true\n",
+			// The invalid line is skipped, not fatal.
+			codeOwners: "lib/ @dave\n[abc] @alice\n",
+			want:       []string{"alice", "bob", "dave"},
+		},
+		{
+			desc:   "load balancing requests the least loaded reviewers",
+			author: "carol",
+			yaml:   testConfig + balancedPool,
+			load:   map[string]int{"alice": 3, "bob": 1},
+			want:   []string{"bob", "dave"},
+		},
+		{
+			desc:      "load balancing keeps reviewers already requested",
+			author:    "carol",
+			yaml:      testConfig + balancedPool,
+			requested: []string{"alice"},
+			load:      map[string]int{"alice": 3, "bob": 1},
+			want:      []string{"alice", "dave"},
+		},
+		{
+			desc:   "out of office reviewers are skipped",
+			author: "carol",
+			yaml:   testConfig,
+			away:   []string{"bob"},
+			want:   []string{"alice"},
+		},
+		{
+			desc:   "busy reviewers are skipped",
+			author: "carol",
+			yaml:   testConfig + "availability:\n  github_status: true\n",
+			busy:   []string{"alice"},
+			want:   []string{"bob"},
+		},
+		{
+			desc:   "GitHub status is ignored unless enabled",
+			author: "carol",
+			yaml:   testConfig,
+			busy:   []string{"alice"},
+			want:   []string{"alice", "bob"},
+		},
+		{
+			desc:   "unavailable pool reviewers are substituted from the defaults",
+			author: "carol",
+			yaml:   testConfig + "availability:\n  github_status: true\npools:\n  - name: lib\n    paths: [\"**\"]\n    reviewers: [dave, erin]\n",
+			away:   []string{"dave"},
+			busy:   []string{"erin"},
+			load:   map[string]int{"bob": 1},
+			want:   []string{"alice"},
+		},
+		{
+			desc:   "teams are expanded to as many members as approvals required",
+			author: "carol",
+			yaml:   testConfig + teamPool,
+			teams:  map[string][]string{"core": {"dave", "erin", "carol"}},
+			load:   map[string]int{"dave": 1},
+			want:   []string{"erin"},
+		},
+		{
+			desc:      "teams are requested as a whole with request_teams",
+			author:    "carol",
+			yaml:      testConfig + teamPool + "    request_teams: true\n",
+			teams:     map[string][]string{"core": {"dave", "erin", "carol"}},
+			wantTeams: []string{"core"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			srv := newTestServer(t)
+			if tt.codeOwners != "" {
+				srv.SetContent(".github/CODEOWNERS", tt.codeOwners)
+			}
+			srv.AddPullRequest(githubtest.PullRequest{
+				Number:         1,
+				Author:         tt.author,
+				Files:          []string{"lib/auth.go"},
+				Commits:        []githubtest.Commit{{SHA: "aaa111", Committer: tt.author}},
+				RequestedUsers: tt.requested,
+			})
+			for _, login := range tt.reviewers {
+				srv.Submit(1, login, "COMMENTED")
+			}
+			for _, login := range tt.busy {
+				srv.AddUser(githubtest.User{Login: login, Busy: true})
+			}
+			for slug, members := range tt.teams {
+				srv.AddTeam(slug, members...)
+			}
+			number := 100
+			for login, n := range tt.load {
+				for i := 0; i < n; i++ {
+					number++
+					srv.AddPullRequest(githubtest.PullRequest{Number: number, Author: "zoe", RequestedUsers: []string{login}})
+				}
+			}
+
+			var calendar strings.Builder
+			for _, login := range tt.away {
+				fmt.Fprintf(&calendar, "%v:\n  - from: 2000-01-01\n    to: 2999-12-31\n", login)
+			}
+			cal, err := availability.Parse([]byte(calendar.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				b := newTestBot(t, srv, "pull_request_target", "opened", 1, tt.yaml)
+				b.c.Calendar = cal
+				if err := b.Assign(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pr := srv.PullRequest(1)
+			if !equal(pr.RequestedUsers, tt.want) {
+				t.Errorf("requested %v, want %v", pr.RequestedUsers, tt.want)
+			}
+			if !equal(pr.RequestedTeams, tt.wantTeams) {
+				t.Errorf("requested teams %v, want %v", pr.RequestedTeams, tt.wantTeams)
+			}
+			if comments := statusComments(srv, 1); len(comments) != 1 {
+				t.Errorf("got %v status comments, want 1", len(comments))
+			}
+		})
+	}
+}
+
+// equal reports whether a and b hold the same strings, in any order.
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := map[string]int{}
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		count[s]--
+		if count[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
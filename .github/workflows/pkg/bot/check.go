@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// CheckRunName is the name of the check run reporting the review gate.
+// Branch protection should require this check.
+const CheckRunName = "Review gate"
+
+// Check evaluates the review gate: every pool responsible for the pull
+// request must have given the required number of approvals and, if
+// enabled, each area owned in CODEOWNERS must be approved by one of its
+// owners.
+//
+// When new commits were pushed, stale approvals are dismissed first. The
+// outcome is published as a check run on the head commit, updated in place
+// on re-runs, rather than by failing the job, and in the status comment.
+// An error is only returned if the gate could not be evaluated or
+// published.
+func (b *Bot) Check(ctx context.Context) error {
+	if err := b.requirePullRequest(); err != nil {
+		return err
+	}
+	if b.c.Environment.Action == "synchronize" {
+		if err := b.DismissStaleApprovals(ctx); err != nil {
+			return err
+		}
+	}
+	g, err := b.evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	env := b.c.Environment
+	if g.satisfied() {
+		log.Printf("All required approvals for #%v are present.", env.Number)
+	} else {
+		log.Printf("#%v is missing approvals:\n  %v", env.Number, strings.Join(g.missing(), "\n  "))
+	}
+	if err := b.publishCheckRun(ctx, g); err != nil {
+		return err
+	}
+	return b.updateStatusComment(ctx, g)
+}
+
+// publishCheckRun creates or updates the review gate check run on the pull
+// request head.
+func (b *Bot) publishCheckRun(ctx context.Context, g *gate) error {
+	env := b.c.Environment
+	conclusion := "success"
+	if !g.satisfied() {
+		conclusion = "failure"
+	}
+	output := &github.CheckRunOutput{
+		Title:   github.String(g.title()),
+		Summary: github.String(g.summary()),
+	}
+	now := &github.Timestamp{Time: time.Now()}
+
+	runs, _, err := b.c.GitHub.Checks.ListCheckRunsForRef(ctx, env.Organization, env.Repository, env.HeadSHA,
+		&github.ListCheckRunsOptions{CheckName: github.String(CheckRunName)})
+	if err != nil {
+		return err
+	}
+	if len(runs.CheckRuns) != 0 {
+		run := runs.CheckRuns[0]
+		log.Printf("Updating check run %v on %.7v: %v.", run.GetID(), env.HeadSHA, conclusion)
+		_, _, err = b.c.GitHub.Checks.UpdateCheckRun(ctx, env.Organization, env.Repository, run.GetID(), github.UpdateCheckRunOptions{
+			Name:        CheckRunName,
+			Status:      github.String("completed"),
+			Conclusion:  github.String(conclusion),
+			CompletedAt: now,
+			Output:      output,
+		})
+		return err
+	}
+	log.Printf("Creating check run on %.7v: %v.", env.HeadSHA, conclusion)
+	_, _, err = b.c.GitHub.Checks.CreateCheckRun(ctx, env.Organization, env.Repository, github.CreateCheckRunOptions{
+		Name:        CheckRunName,
+		HeadSHA:     env.HeadSHA,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: now,
+		Output:      output,
+	})
+	return err
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/codeowners"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+)
+
+// ownedArea is a set of changed files governed by the same CODEOWNERS rule.
+// One approval from any of its owners satisfies the area.
+type ownedArea struct {
+	// Rule is the CODEOWNERS rule that owns the files.
+	Rule codeowners.Rule
+	// Owners are the rule's owners, excluding the pull request author.
+	Owners []string
+	// Files are the changed files the rule owns.
+	Files []string
+}
+
+// loadCodeOwners reads the CODEOWNERS file from the pull request's base
+// branch, the same copy GitHub uses. It returns nil if the repository has
+// no CODEOWNERS file.
+func (b *Bot) loadCodeOwners(ctx context.Context) (*codeowners.File, error) {
+	env := b.c.Environment
+	opts := &github.RepositoryContentGetOptions{Ref: env.BaseRef}
+	for _, path := range codeowners.Locations {
+		content, _, resp, err := b.c.GitHub.Repositories.GetContents(ctx, env.Organization, env.Repository, path, opts)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, err
+		}
+		text, err := content.GetContent()
+		if err != nil {
+			return nil, err
+		}
+		return codeowners.Parse(strings.NewReader(text))
+	}
+	return nil, nil
+}
+
+// ownedAreas groups the changed files by the CODEOWNERS rule that owns them.
+// Unowned files, and files owned only by the author, are left out.
+func (b *Bot) ownedAreas(ctx context.Context, files []string) ([]ownedArea, error) {
+	if !b.c.Reviewers.CodeOwners {
+		return nil, nil
+	}
+	f, err := b.loadCodeOwners(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		log.Printf("CODEOWNERS is enabled but the repository has none.")
+		return nil, nil
+	}
+	author := b.c.Environment.Author
+	byLine := map[int]*ownedArea{}
+	for _, file := range files {
+		rule := f.Match(file)
+		if rule == nil || len(rule.Owners) == 0 {
+			continue
+		}
+		area, ok := byLine[rule.Line]
+		if !ok {
+			area = &ownedArea{Rule: *rule}
+			for _, owner := range rule.Owners {
+				if !strings.EqualFold(strings.TrimPrefix(owner, "@"), author) {
+					area.Owners = append(area.Owners, owner)
+				}
+			}
+			byLine[rule.Line] = area
+		}
+		area.Files = append(area.Files, file)
+	}
+
+	var areas []ownedArea
+	for _, area := range byLine {
+		if len(area.Owners) == 0 {
+			log.Printf("Skipping CODEOWNERS line %v: owned only by the author.", area.Rule.Line)
+			continue
+		}
+		areas = append(areas, *area)
+	}
+	sort.Slice(areas, func(i, j int) bool { return areas[i].Rule.Line < areas[j].Rule.Line })
+	return areas, nil
+}
+
+// resolveOwner maps a CODEOWNERS owner to the login or "@org/team"
+// reference used elsewhere by the bot. Email owners are looked up among
+// users with that public email. It returns "" if the owner cannot be
+// resolved.
+func (b *Bot) resolveOwner(ctx context.Context, owner string) string {
+	switch {
+	case codeowners.IsTeam(owner):
+		return owner
+	case codeowners.IsEmail(owner):
+		if login, ok := b.emails[owner]; ok {
+			return login
+		}
+		login := ""
+		result, _, err := b.c.GitHub.Search.Users(ctx, owner+" in:email", nil)
+		if err == nil && len(result.Users) == 1 {
+			login = result.Users[0].GetLogin()
+		} else {
+			log.Printf("Unable to resolve CODEOWNERS email %v to a user.", owner)
+		}
+		b.emails[owner] = login
+		return login
+	default:
+		return strings.TrimPrefix(owner, "@")
+	}
+}
+
+// ownerApproved reports whether owner, a login or "@org/team" reference,
+// is satisfied by one of the approvers.
+func (b *Bot) ownerApproved(ctx context.Context, owner string, approvers []string) bool {
+	isTeamMember := b.isTeamMember(ctx)
+	for _, approver := range approvers {
+		if org, slug, ok := config.ParseTeam(owner); ok {
+			if isTeamMember(org, slug, approver) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(owner, approver) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/verify"
+)
+
+// statusMarker identifies the bot's status comment. It is invisible when
+// the comment is rendered.
+const statusMarker = "<!-- review-bot:status -->"
+
+// updateStatusComment keeps a single status comment on the pull request up
+// to date, editing it in place. Workflows whose token cannot write issue
+// comments skip the comment instead of failing.
+//
+// Runs for the same pull request can race to create the comment, so after
+// creating it the comments are listed again and every status comment but
+// the oldest is deleted. All racers agree on the oldest one. Dry runs
+// create nothing, so the listing comes back empty and the comment that
+// would have been created stands in for it.
+func (b *Bot) updateStatusComment(ctx context.Context, g *gate) error {
+	body, err := b.statusComment(ctx, g)
+	if err != nil {
+		return err
+	}
+	env := b.c.Environment
+	existing, resp, err := b.listStatusComments(ctx)
+	if err != nil {
+		return skipIfForbidden(resp, err)
+	}
+	if len(existing) == 0 {
+		log.Printf("Creating status comment on #%v.", env.Number)
+		created, resp, err := b.c.GitHub.Issues.CreateComment(ctx, env.Organization, env.Repository, env.Number,
+			&github.IssueComment{Body: github.String(body)})
+		if err != nil {
+			return skipIfForbidden(resp, err)
+		}
+		existing, resp, err = b.listStatusComments(ctx)
+		if err != nil {
+			return skipIfForbidden(resp, err)
+		}
+		if len(existing) == 0 {
+			existing = []*github.IssueComment{created}
+		}
+	}
+	kept := existing[0]
+	for _, c := range existing[1:] {
+		log.Printf("Deleting duplicate status comment %v on #%v.", c.GetID(), env.Number)
+		resp, err := b.c.GitHub.Issues.DeleteComment(ctx, env.Organization, env.Repository, c.GetID())
+		// Another run may have deleted it first.
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return skipIfForbidden(resp, err)
+		}
+	}
+	if kept.GetBody() == body {
+		log.Printf("Status comment %v is up to date.", kept.GetID())
+		return nil
+	}
+	log.Printf("Updating status comment %v on #%v.", kept.GetID(), env.Number)
+	_, resp, err = b.c.GitHub.Issues.EditComment(ctx, env.Organization, env.Repository, kept.GetID(),
+		&github.IssueComment{Body: github.String(body)})
+	return skipIfForbidden(resp, err)
+}
+
+// listStatusComments returns the comments carrying the status marker,
+// oldest first. Comment IDs increase over time.
+func (b *Bot) listStatusComments(ctx context.Context) ([]*github.IssueComment, *github.Response, error) {
+	env := b.c.Environment
+	var comments []*github.IssueComment
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := b.c.GitHub.Issues.ListComments(ctx, env.Organization, env.Repository, env.Number, opts)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, c := range page {
+			if strings.Contains(c.GetBody(), statusMarker) {
+				comments = append(comments, c)
+			}
+		}
+		if resp.NextPage == 0 {
+			sort.SliceStable(comments, func(i, j int) bool { return comments[i].GetID() < comments[j].GetID() })
+			return comments, resp, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// statusComment renders the status comment.
+func (b *Bot) statusComment(ctx context.Context, g *gate) (string, error) {
+	env := b.c.Environment
+	requested, err := b.listReviewers(ctx)
+	if err != nil {
+		return "", err
+	}
+	commits, err := b.listCommits(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(statusMarker + "\n")
+	sb.WriteString("### Review status\n\n")
+
+	var assigned []string
+	for _, u := range requested.Users {
+		assigned = append(assigned, "@"+u.GetLogin())
+	}
+	for _, t := range requested.Teams {
+		assigned = append(assigned, "@"+env.Organization+"/"+t.GetSlug())
+	}
+	fmt.Fprintf(&sb, "**Awaiting review from:** %v\n\n", orDash(strings.Join(assigned, ", ")))
+
+	fmt.Fprintf(&sb, "**Approvals:** %v\n\n", g.title())
+	sb.WriteString(g.summary())
+
+	sb.WriteString("\n**Commits**\n\n")
+	sb.WriteString("| Commit | Committer | Signature |\n")
+	sb.WriteString("| --- | --- | --- |\n")
+	var unverified []string
+	for _, c := range commits {
+		signature := ":white_check_mark: verified"
+		if v := c.GetCommit().GetVerification(); !v.GetVerified() {
+			signature = fmt.Sprintf(":warning: %v", v.GetReason())
+			unverified = append(unverified, fmt.Sprintf("%.7v", c.GetSHA()))
+		} else if c.GetCommitter().GetLogin() == verify.WebFlowLogin {
+			signature += " (GitHub web-flow)"
+		}
+		committer := c.GetCommitter().GetLogin()
+		if committer == "" {
+			committer = c.GetCommit().GetCommitter().GetName()
+		}
+		fmt.Fprintf(&sb, "| %.7v | %v | %v |\n", c.GetSHA(), committer, signature)
+	}
+
+	violations := g.missing()
+	if len(unverified) != 0 {
+		violations = append(violations, fmt.Sprintf("commits without a verified signature: %v", strings.Join(unverified, ", ")))
+	}
+	if len(violations) != 0 {
+		sb.WriteString("\n**Policy violations**\n\n")
+		for _, v := range violations {
+			fmt.Fprintf(&sb, "- %v\n", v)
+		}
+	}
+	return sb.String(), nil
+}
+
+// skipIfForbidden logs and swallows errors caused by the token lacking
+// permission, such as workflows running without "issues: write". Other
+// errors, including 404s for a missing pull request, are returned.
+func skipIfForbidden(resp *github.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	if resp != nil && resp.StatusCode == http.StatusForbidden {
+		log.Printf("Skipping status comment, token lacks permission: %v.", err)
+		return nil
+	}
+	return err
+}
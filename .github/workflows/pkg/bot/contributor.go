@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+)
+
+// classify returns the contributor class of the pull request author.
+//
+// Bots are recognized by their account type. Authors are internal if they
+// are members of the repository's organization or have write access to the
+// repository, and the pull request comes from the repository itself or a
+// fork they or the organization own. Everyone else is external, or a
+// first-time contributor if GitHub reports this as their first pull
+// request.
+func (b *Bot) classify(ctx context.Context) (string, error) {
+	if b.class != "" {
+		return b.class, nil
+	}
+	env := b.c.Environment
+	pr := env.PullRequest()
+	author := pr.GetUser()
+
+	class := config.External
+	switch {
+	case author.GetType() == "Bot" || strings.HasSuffix(env.Author, "[bot]"):
+		class = config.Bot
+	default:
+		trusted, err := b.trusted(ctx, env.Author)
+		if err != nil {
+			return "", err
+		}
+		headOwner := pr.GetHead().GetRepo().GetOwner().GetLogin()
+		ownHead := !env.Fork || strings.EqualFold(headOwner, env.Author) || strings.EqualFold(headOwner, env.Organization)
+		switch association := pr.GetAuthorAssociation(); {
+		case trusted && ownHead:
+			class = config.Internal
+		case association == "FIRST_TIME_CONTRIBUTOR" || association == "FIRST_TIMER":
+			class = config.FirstTime
+		}
+	}
+	log.Printf("%v is a %v contributor.", env.Author, class)
+	b.class = class
+	return class, nil
+}
+
+// trusted reports whether login is a member of the repository's
+// organization or has write access to the repository.
+func (b *Bot) trusted(ctx context.Context, login string) (bool, error) {
+	env := b.c.Environment
+	member, resp, err := b.c.GitHub.Organizations.IsMember(ctx, env.Organization, login)
+	// Repositories owned by users rather than organizations answer 404.
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return false, err
+	}
+	if member {
+		return true, nil
+	}
+	level, _, err := b.c.GitHub.Repositories.GetPermissionLevel(ctx, env.Organization, env.Repository, login)
+	if err != nil {
+		return false, err
+	}
+	switch level.GetPermission() {
+	case "admin", "write":
+		return true, nil
+	}
+	return false, nil
+}
+
+// author returns the pull request author for pool matching.
+func (b *Bot) author(ctx context.Context) (config.Author, error) {
+	class, err := b.classify(ctx)
+	if err != nil {
+		return config.Author{}, err
+	}
+	return config.Author{
+		Login:        b.c.Environment.Author,
+		Class:        class,
+		IsTeamMember: b.isTeamMember(ctx),
+	}, nil
+}
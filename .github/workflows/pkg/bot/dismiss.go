@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+)
+
+// DismissStaleApprovals dismisses approvals of a pull request by an
+// external contributor when commits other than those created by GitHub
+// itself were pushed after the approval. Merging the base branch through
+// the "Update branch" button or applying review suggestions produces
+// web-flow commits and keeps approvals in place; anything pushed by the
+// contributor needs a new review.
+func (b *Bot) DismissStaleApprovals(ctx context.Context) error {
+	if err := b.requirePullRequest(); err != nil {
+		return err
+	}
+	env := b.c.Environment
+	class, err := b.classify(ctx)
+	if err != nil {
+		return err
+	}
+	if class != config.External && class != config.FirstTime {
+		log.Printf("#%v is by a %v contributor, keeping approvals.", env.Number, class)
+		return nil
+	}
+	reviews, err := b.listReviews(ctx)
+	if err != nil {
+		return err
+	}
+	commits, err := b.listCommits(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, review := range latestReviews(reviews) {
+		if review.GetState() != "APPROVED" || review.GetCommitID() == env.HeadSHA {
+			continue
+		}
+		pushed := b.pushedSince(commits, review.GetCommitID())
+		if len(pushed) == 0 {
+			log.Printf("Keeping approval by %v: only web-flow commits since %.7v.",
+				review.GetUser().GetLogin(), review.GetCommitID())
+			continue
+		}
+		msg := fmt.Sprintf("Dismissed: new commits (%v) were pushed by the contributor after this approval. Please review the changes again.",
+			strings.Join(pushed, ", "))
+		log.Printf("Dismissing approval by %v: %v", review.GetUser().GetLogin(), msg)
+		_, _, err := b.c.GitHub.PullRequests.DismissReview(ctx, env.Organization, env.Repository, env.Number, review.GetID(),
+			&github.PullRequestReviewDismissalRequest{Message: github.String(msg)})
+		if err != nil {
+			return err
+		}
+		b.pr = nil
+	}
+	return nil
+}
+
+// pushedSince returns the short SHAs of the commits after sha that were
+// not created by GitHub web-flow. If sha is no longer part of the pull
+// request, for example after a force push, every commit is considered.
+func (b *Bot) pushedSince(commits []*github.RepositoryCommit, sha string) []string {
+	start := 0
+	for i, c := range commits {
+		if c.GetSHA() == sha {
+			start = i + 1
+			break
+		}
+	}
+	var pushed []string
+	for _, c := range commits[start:] {
+		if !b.c.IsWebFlow(c) {
+			pushed = append(pushed, fmt.Sprintf("%.7v", c.GetSHA()))
+		}
+	}
+	return pushed
+}
+
+// listCommits returns the commits of the pull request, oldest first.
+func (b *Bot) listCommits(ctx context.Context) ([]*github.RepositoryCommit, error) {
+	if b.c.GraphQL {
+		pr, err := b.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pr.Commits, nil
+	}
+	env := b.c.Environment
+	var commits []*github.RepositoryCommit
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := b.c.GitHub.PullRequests.ListCommits(ctx, env.Organization, env.Repository, env.Number, opts)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			return commits, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// gate is the outcome of the review gate for a pull request.
+type gate struct {
+	// Groups are the reviewer pools and CODEOWNERS areas that must approve.
+	Groups []gateGroup
+}
+
+// gateGroup is the approval state of a pool or CODEOWNERS area.
+type gateGroup struct {
+	// Name describes the group.
+	Name string
+	// Required is the number of approvals the group needs.
+	Required int
+	// Approved are the reviewers whose approval counts towards the group.
+	Approved []string
+	// Pending are the reviewers the group is still waiting on.
+	Pending []pendingReviewer
+}
+
+// pendingReviewer is a reviewer who has not approved, and why.
+type pendingReviewer struct {
+	Login  string
+	Reason string
+}
+
+// satisfied reports whether the group has enough approvals.
+func (g gateGroup) satisfied() bool {
+	return len(g.Approved) >= g.Required
+}
+
+// satisfied reports whether every group has enough approvals.
+func (g *gate) satisfied() bool {
+	for _, group := range g.Groups {
+		if !group.satisfied() {
+			return false
+		}
+	}
+	return true
+}
+
+// title returns a one line description of the gate.
+func (g *gate) title() string {
+	done := 0
+	for _, group := range g.Groups {
+		if group.satisfied() {
+			done++
+		}
+	}
+	if done == len(g.Groups) {
+		return "All required approvals present"
+	}
+	return fmt.Sprintf("%v of %v review groups approved", done, len(g.Groups))
+}
+
+// summary renders the gate as Markdown.
+func (g *gate) summary() string {
+	var sb strings.Builder
+	sb.WriteString("| Group | Approvals | Approved by | Pending |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+	for _, group := range g.Groups {
+		mark := ":x:"
+		if group.satisfied() {
+			mark = ":white_check_mark:"
+		}
+		var pending []string
+		for _, p := range group.Pending {
+			pending = append(pending, fmt.Sprintf("@%v (%v)", p.Login, p.Reason))
+		}
+		fmt.Fprintf(&sb, "| %v %v | %v/%v | %v | %v |\n", mark, group.Name,
+			len(group.Approved), group.Required, mentions(group.Approved), orDash(strings.Join(pending, ", ")))
+	}
+	return sb.String()
+}
+
+// missing describes the unsatisfied groups, one per line.
+func (g *gate) missing() []string {
+	var lines []string
+	for _, group := range g.Groups {
+		if group.satisfied() {
+			continue
+		}
+		var pending []string
+		for _, p := range group.Pending {
+			pending = append(pending, p.Login)
+		}
+		lines = append(lines, fmt.Sprintf("%v: %v of %v approvals, waiting on %v",
+			group.Name, len(group.Approved), group.Required, strings.Join(pending, ", ")))
+	}
+	return lines
+}
+
+// evaluate works out the state of the review gate.
+func (b *Bot) evaluate(ctx context.Context) (*gate, error) {
+	files, err := b.listFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	areas, err := b.ownedAreas(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	reviews, err := b.listReviews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	latest := latestReviews(reviews)
+	var approvers []string
+	for login, review := range latest {
+		if review.GetState() == "APPROVED" {
+			approvers = append(approvers, login)
+		}
+	}
+	sort.Strings(approvers)
+	isApproved := func(login string) bool {
+		review, ok := latest[strings.ToLower(login)]
+		return ok && review.GetState() == "APPROVED"
+	}
+	pendingReason := func(login string) string {
+		return reviewStateReason(latest[strings.ToLower(login)])
+	}
+
+	g := &gate{}
+	pools, err := b.pools(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pools {
+		s, err := b.staff(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		group := gateGroup{Name: fmt.Sprintf("Pool %v", p.Name), Required: s.Required}
+		for _, r := range s.Candidates {
+			switch {
+			case isApproved(r):
+				group.Approved = append(group.Approved, r)
+			case b.available(ctx, r):
+				group.Pending = append(group.Pending, pendingReviewer{Login: r, Reason: pendingReason(r)})
+			default:
+				group.Pending = append(group.Pending, pendingReviewer{Login: r, Reason: "unavailable"})
+			}
+		}
+		// Substitutes only fill the slots of absent candidates.
+		slots := s.absent()
+		for _, r := range s.Substitutes {
+			switch {
+			case isApproved(r) && slots > 0:
+				group.Approved = append(group.Approved, r)
+				slots--
+			case !isApproved(r):
+				group.Pending = append(group.Pending, pendingReviewer{Login: r, Reason: "substitute, " + pendingReason(r)})
+			}
+		}
+		g.Groups = append(g.Groups, group)
+	}
+	for _, area := range areas {
+		group := gateGroup{
+			Name:     fmt.Sprintf("CODEOWNERS `%v` (line %v)", area.Rule.Pattern, area.Rule.Line),
+			Required: 1,
+		}
+		for _, owner := range area.Owners {
+			login := b.resolveOwner(ctx, owner)
+			if login == "" {
+				group.Pending = append(group.Pending, pendingReviewer{Login: owner, Reason: "unknown owner"})
+				continue
+			}
+			approved := false
+			for _, a := range approvers {
+				if b.ownerApproved(ctx, login, []string{a}) {
+					group.Approved = appendUnique(group.Approved, a)
+					approved = true
+				}
+			}
+			if approved {
+				continue
+			}
+			group.Pending = append(group.Pending, pendingReviewer{Login: strings.TrimPrefix(login, "@"), Reason: pendingReason(login)})
+		}
+		g.Groups = append(g.Groups, group)
+	}
+	return g, nil
+}
+
+// reviewStateReason explains why a reviewer with the given latest review
+// has not approved.
+func reviewStateReason(review *github.PullRequestReview) string {
+	switch review.GetState() {
+	case "CHANGES_REQUESTED":
+		return "requested changes"
+	case "DISMISSED":
+		return "approval dismissed"
+	}
+	return "review pending"
+}
+
+// mentions formats logins as @-mentions.
+func mentions(logins []string) string {
+	var out []string
+	for _, l := range logins {
+		out = append(out, "@"+l)
+	}
+	return orDash(strings.Join(out, ", "))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// appendUnique appends s to list unless it is already present.
+func appendUnique(list []string, s string) []string {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"context"
+	"log"
+)
+
+// Handle runs the actions the workflows run for the event in the
+// environment. It is used when the bot receives events directly rather
+// than from a workflow.
+func (b *Bot) Handle(ctx context.Context) error {
+	env := b.c.Environment
+	switch env.EventName {
+	case "pull_request", "pull_request_target":
+		switch env.Action {
+		case "opened", "reopened", "ready_for_review", "assigned":
+			if err := b.Assign(ctx); err != nil {
+				return err
+			}
+			return b.Check(ctx)
+		case "synchronize":
+			return b.Check(ctx)
+		}
+	case "pull_request_review":
+		return b.Check(ctx)
+	case "workflow_run":
+		switch env.Action {
+		// Older runs are cancelled as soon as a newer one is requested.
+		case "requested":
+			return b.DismissRuns(ctx)
+		case "completed":
+			return b.RerunCheck(ctx)
+		}
+	case "push", "schedule":
+		return b.DismissRuns(ctx)
+	}
+	log.Printf("Nothing to do for %v event with action %q.", env.EventName, env.Action)
+	return nil
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+)
+
+// selectReviewers picks n reviewers from candidates by current review load.
+//
+// Candidates already requested on, or who already reviewed, the pull
+// request are kept first so that re-running assignment does not move the
+// request to someone else. Remaining slots go to the candidates with the
+// fewest open review requests. Ties are broken by a shuffle seeded with the
+// pull request number, which spreads ties across reviewers while keeping
+// reruns for the same pull request deterministic.
+func (b *Bot) selectReviewers(ctx context.Context, candidates []string, n int) ([]string, error) {
+	if n >= len(candidates) {
+		return candidates, nil
+	}
+	involved, err := b.involvedReviewers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected, rest []string
+	for _, c := range candidates {
+		if involved[strings.ToLower(c)] && len(selected) < n {
+			selected = append(selected, c)
+			continue
+		}
+		rest = append(rest, c)
+	}
+	if len(selected) == n {
+		return selected, nil
+	}
+
+	loads := make(map[string]int, len(rest))
+	for _, c := range rest {
+		load, err := b.reviewLoad(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		loads[c] = load
+	}
+	r := rand.New(rand.NewSource(int64(b.c.Environment.Number)))
+	r.Shuffle(len(rest), func(i, j int) { rest[i], rest[j] = rest[j], rest[i] })
+	sort.SliceStable(rest, func(i, j int) bool { return loads[rest[i]] < loads[rest[j]] })
+
+	for _, c := range rest[:n-len(selected)] {
+		log.Printf("Selected %v with %v open review requests.", c, loads[c])
+	}
+	return append(selected, rest[:n-len(selected)]...), nil
+}
+
+// involvedReviewers returns the lowercased logins of users who are
+// requested on or have reviewed the pull request.
+func (b *Bot) involvedReviewers(ctx context.Context) (map[string]bool, error) {
+	if b.involved != nil {
+		return b.involved, nil
+	}
+	involved := map[string]bool{}
+	requested, err := b.listReviewers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range requested.Users {
+		involved[strings.ToLower(u.GetLogin())] = true
+	}
+	reviews, err := b.listReviews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reviews {
+		involved[strings.ToLower(r.GetUser().GetLogin())] = true
+	}
+	b.involved = involved
+	return involved, nil
+}
+
+// reviewLoad returns the number of open pull requests in the repository
+// owner's account on which login is a requested reviewer.
+func (b *Bot) reviewLoad(ctx context.Context, login string) (int, error) {
+	if load, ok := b.loads[strings.ToLower(login)]; ok {
+		return load, nil
+	}
+	query := fmt.Sprintf("is:pr is:open review-requested:%v user:%v", login, b.c.Environment.Organization)
+	result, _, err := b.c.GitHub.Search.Issues(ctx, query, nil)
+	if err != nil {
+		return 0, err
+	}
+	b.loads[strings.ToLower(login)] = result.GetTotal()
+	return result.GetTotal(), nil
+}
+
+// poolReviewers returns the reviewers to request from pool p.
+//
+// Pools requesting teams get their individual reviewers plus the teams
+// themselves. Otherwise teams are expanded to their members and the pool
+// gets its available candidates, or only as many as required if the pool
+// is load balanced or contains teams, plus any substitutes for absent
+// candidates.
+func (b *Bot) poolReviewers(ctx context.Context, p config.Pool) ([]string, error) {
+	if p.RequestTeams && p.HasTeams() {
+		users, teams := b.teamReviewers(p)
+		var available []string
+		for _, u := range users {
+			if b.available(ctx, u) {
+				available = append(available, u)
+			}
+		}
+		if p.LoadBalance {
+			required, err := b.required(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			if available, err = b.selectReviewers(ctx, available, min(required, len(available))); err != nil {
+				return nil, err
+			}
+		}
+		return append(append([]string{}, available...), teams...), nil
+	}
+
+	s, err := b.staff(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	reviewers := s.Available
+	if p.LoadBalance || p.HasTeams() {
+		if reviewers, err = b.selectReviewers(ctx, s.Available, min(s.Required, len(s.Available))); err != nil {
+			return nil, err
+		}
+	}
+	return append(append([]string{}, reviewers...), s.Substitutes...), nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// RerunCheck re-runs the review gate of a pull request from a fork after
+// a review.
+//
+// Workflows triggered by pull_request_review events on pull requests from
+// forks get a read-only token, so the review gate they run cannot update
+// the pull request. RerunCheck handles the workflow_run event for the
+// completion of such a run, which gets a write token, and re-runs the
+// latest pull_request_target run of the same workflow for the reviewed
+// commit. That run has a write token and reports the gate with the new
+// review counted.
+func (b *Bot) RerunCheck(ctx context.Context) error {
+	env := b.c.Environment
+	e, ok := env.Event.(*github.WorkflowRunEvent)
+	if !ok {
+		log.Printf("Nothing to re-run for %v event.", env.EventName)
+		return nil
+	}
+	review := e.GetWorkflowRun()
+	if review.GetEvent() != "pull_request_review" {
+		log.Printf("Run %v was triggered by %v, not a review.", review.GetID(), review.GetEvent())
+		return nil
+	}
+	head, base := review.GetHeadRepository().GetFullName(), e.GetRepo().GetFullName()
+	if head != "" && strings.EqualFold(head, base) {
+		log.Printf("Run %v is for a pull request from %v itself, its token could update the review gate.", review.GetID(), base)
+		return nil
+	}
+
+	run, err := b.latestTargetRun(ctx, review)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		log.Printf("Found no pull_request_target run of %q for %v.", review.GetName(), review.GetHeadSHA())
+		return nil
+	}
+	// A run that has not finished yet will read the reviews when it gets
+	// to the review gate.
+	if run.GetStatus() != "completed" {
+		log.Printf("Run %v for %v is still %v, not re-running it.", run.GetID(), review.GetHeadSHA(), run.GetStatus())
+		return nil
+	}
+	log.Printf("Re-running run %v of %q for %v after a review from a fork.", run.GetID(), run.GetName(), review.GetHeadSHA())
+	_, err = b.c.GitHub.Actions.RerunWorkflowByID(ctx, env.Organization, env.Repository, run.GetID())
+	return err
+}
+
+// latestTargetRun returns the newest pull_request_target run of the
+// workflow of review for the same head commit, or nil if there is none.
+// Runs are listed newest first, so listing stops at the first match.
+func (b *Bot) latestTargetRun(ctx context.Context, review *github.WorkflowRun) (*github.WorkflowRun, error) {
+	env := b.c.Environment
+	opts := &github.ListWorkflowRunsOptions{
+		Event:       "pull_request_target",
+		Branch:      review.GetHeadBranch(),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := b.c.GitHub.Actions.ListWorkflowRunsByID(ctx, env.Organization, env.Repository, review.GetWorkflowID(), opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range page.WorkflowRuns {
+			if run.GetHeadSHA() == review.GetHeadSHA() {
+				return run, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/environment"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/githubtest"
+)
+
+func TestRerunCheck(t *testing.T) {
+	tests := []struct {
+		desc string
+		// head is the repository the reviewed pull request comes from.
+		head string
+		// target is the pull_request_target run for the reviewed commit,
+		// if any.
+		target *githubtest.Run
+		rerun  bool
+	}{
+		{
+			desc:   "review of a pull request from a fork",
+			head:   "eve/teleport",
+			target: &githubtest.Run{HeadSHA: "aaa111", Status: "completed", Conclusion: "success"},
+			rerun:  true,
+		},
+		{
+			desc:   "target run still in progress",
+			head:   "eve/teleport",
+			target: &githubtest.Run{HeadSHA: "aaa111", Status: "in_progress"},
+		},
+		{
+			desc:   "target run for another commit",
+			head:   "eve/teleport",
+			target: &githubtest.Run{HeadSHA: "bbb222", Status: "completed", Conclusion: "success"},
+		},
+		{
+			desc: "no target run",
+			head: "eve/teleport",
+		},
+		{
+			desc:   "review of a pull request from the repository",
+			head:   testOwner + "/" + testRepo,
+			target: &githubtest.Run{HeadSHA: "aaa111", Status: "completed", Conclusion: "success"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			srv := newTestServer(t)
+			var targetID int64
+			if tt.target != nil {
+				run := *tt.target
+				run.WorkflowID, run.Path, run.Name = 1, ".github/workflows/check.yml", "Check"
+				run.Event, run.HeadBranch, run.RunNumber = "pull_request_target", "pr-1", 1
+				targetID = srv.AddRun(run)
+			}
+			reviewID := srv.AddRun(githubtest.Run{
+				WorkflowID: 1,
+				Path:       ".github/workflows/check.yml",
+				Name:       "Check",
+				Event:      "pull_request_review",
+				HeadBranch: "pr-1",
+				HeadSHA:    "aaa111",
+				RunNumber:  2,
+				Status:     "completed",
+				Conclusion: "success",
+			})
+			payload, err := json.Marshal(&github.WorkflowRunEvent{
+				Action: github.String("completed"),
+				WorkflowRun: &github.WorkflowRun{
+					ID:             github.Int64(reviewID),
+					WorkflowID:     github.Int64(1),
+					Name:           github.String("Check"),
+					Event:          github.String("pull_request_review"),
+					HeadBranch:     github.String("pr-1"),
+					HeadSHA:        github.String("aaa111"),
+					Status:         github.String("completed"),
+					HeadRepository: &github.Repository{FullName: github.String(tt.head)},
+				},
+				Repo: &github.Repository{
+					Name:     github.String(testRepo),
+					FullName: github.String(testOwner + "/" + testRepo),
+					Owner:    &github.User{Login: github.String(testOwner)},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			env, err := environment.Parse("workflow_run", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b := newEventBot(t, srv, env, "")
+			if err := b.RerunCheck(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			rerun := false
+			for _, r := range srv.Runs() {
+				if r.Attempts > 0 {
+					if r.ID != targetID {
+						t.Errorf("re-ran run %v of %v, want %v", r.ID, r.Event, targetID)
+					}
+					rerun = true
+				}
+			}
+			if rerun != tt.rerun {
+				t.Errorf("re-ran %v, want %v", rerun, tt.rerun)
+			}
+		})
+	}
+}
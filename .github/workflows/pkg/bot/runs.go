@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// DismissRuns cancels queued and in progress workflow runs that have been
+// superseded by a newer run with the same concurrency key, see
+// concurrencyKey.
+//
+// On a schedule, every in-flight run of the repository is considered. On a
+// workflow_run event, only the runs sharing the key of the run in the
+// event are, so that older runs are cancelled as soon as a new one is
+// requested rather than at the next scheduled sweep.
+func (b *Bot) DismissRuns(ctx context.Context) error {
+	env := b.c.Environment
+	var (
+		runs    []*github.WorkflowRun
+		trigger *github.WorkflowRun
+		opts    github.ListWorkflowRunsOptions
+	)
+	if e, ok := env.Event.(*github.WorkflowRunEvent); ok {
+		trigger = e.GetWorkflowRun()
+		opts.Branch = trigger.GetHeadBranch()
+	}
+	for _, status := range []string{"queued", "in_progress"} {
+		opts := opts
+		opts.Status = status
+		page, err := b.listRuns(ctx, &opts)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, page...)
+	}
+	if trigger != nil {
+		runs = sameKey(runs, trigger)
+	}
+
+	var defaultBranch string
+	if b.c.KeepDefaultBranch {
+		var err error
+		if defaultBranch, err = b.defaultBranch(ctx); err != nil {
+			return err
+		}
+	}
+
+	newest := map[string]*github.WorkflowRun{}
+	for _, run := range runs {
+		key := concurrencyKey(run)
+		if n, ok := newest[key]; !ok || run.GetRunNumber() > n.GetRunNumber() {
+			newest[key] = run
+		}
+	}
+	for _, run := range runs {
+		key := concurrencyKey(run)
+		if !supersedes(newest[key], run) {
+			continue
+		}
+		if defaultBranch != "" && onBranch(run, defaultBranch) {
+			log.Printf("Keeping run %v of %q on the default branch %v.", run.GetID(), run.GetName(), defaultBranch)
+			continue
+		}
+		log.Printf("Cancelling run %v of %q for %v, superseded by run %v.",
+			run.GetID(), run.GetName(), key, newest[key].GetID())
+		resp, err := b.c.GitHub.Actions.CancelWorkflowRunByID(ctx, env.Organization, env.Repository, run.GetID())
+		// A conflict means the run finished or was cancelled meanwhile, e.g.
+		// by an earlier delivery of the same event.
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			log.Printf("Run %v already finished.", run.GetID())
+			continue
+		}
+		// Cancellation is asynchronous and answered with 202 Accepted.
+		if _, ok := err.(*github.AcceptedError); ok {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// concurrencyKey returns the key runs superseding each other share: the
+// workflow, the event that triggered the run, and the pull request the run
+// is for or else the branch it runs on. Runs for pull requests from forks
+// do not list their pull request, so the branch is qualified by the
+// repository it lives in.
+//
+// Runs for different events do different work: the pull_request_target run
+// for a push dismisses stale approvals, which a pull_request_review run
+// does not, so neither supersedes the other.
+func concurrencyKey(run *github.WorkflowRun) string {
+	if prs := run.PullRequests; len(prs) > 0 {
+		return fmt.Sprintf("workflow %v, %v, pull request #%v", run.GetWorkflowID(), run.GetEvent(), prs[0].GetNumber())
+	}
+	branch := run.GetHeadBranch()
+	if repo := run.GetHeadRepository().GetFullName(); repo != "" {
+		branch = repo + ":" + branch
+	}
+	return fmt.Sprintf("workflow %v, %v, branch %v", run.GetWorkflowID(), run.GetEvent(), branch)
+}
+
+// supersedes reports whether newer, a newer run with the same concurrency
+// key, makes run redundant. Runs do not record the activity type of their
+// event, so a newer pull_request_target run for the same commit may be for
+// e.g. an assignment rather than the push run handles. A newer run for
+// another commit is for a later push and dismisses stale approvals itself.
+func supersedes(newer, run *github.WorkflowRun) bool {
+	if newer.GetID() == run.GetID() {
+		return false
+	}
+	return run.GetEvent() != "pull_request_target" || newer.GetHeadSHA() != run.GetHeadSHA()
+}
+
+// sameKey returns the runs sharing the concurrency key of run, including
+// run itself if it is not listed yet.
+func sameKey(runs []*github.WorkflowRun, run *github.WorkflowRun) []*github.WorkflowRun {
+	key := concurrencyKey(run)
+	out := []*github.WorkflowRun{}
+	listed := false
+	for _, r := range runs {
+		if concurrencyKey(r) != key {
+			continue
+		}
+		listed = listed || r.GetID() == run.GetID()
+		out = append(out, r)
+	}
+	if !listed && run.GetStatus() != "completed" {
+		out = append(out, run)
+	}
+	return out
+}
+
+// onBranch returns whether run is for a push or schedule on branch of the
+// repository itself, rather than for a pull request.
+func onBranch(run *github.WorkflowRun, branch string) bool {
+	if len(run.PullRequests) > 0 || run.GetHeadBranch() != branch {
+		return false
+	}
+	head, repo := run.GetHeadRepository().GetFullName(), run.GetRepository().GetFullName()
+	return head == "" || repo == "" || head == repo
+}
+
+// defaultBranch returns the repository's default branch, from the event if
+// it carries the repository.
+func (b *Bot) defaultBranch(ctx context.Context) (string, error) {
+	env := b.c.Environment
+	if env.DefaultBranch != "" {
+		return env.DefaultBranch, nil
+	}
+	repo, _, err := b.c.GitHub.Repositories.Get(ctx, env.Organization, env.Repository)
+	if err != nil {
+		return "", err
+	}
+	env.DefaultBranch = repo.GetDefaultBranch()
+	return env.DefaultBranch, nil
+}
+
+// listRuns returns every workflow run in the repository matching opts.
+func (b *Bot) listRuns(ctx context.Context, opts *github.ListWorkflowRunsOptions) ([]*github.WorkflowRun, error) {
+	env := b.c.Environment
+	var runs []*github.WorkflowRun
+	opts.PerPage = 100
+	for {
+		page, resp, err := b.c.GitHub.Actions.ListRepositoryWorkflowRuns(ctx, env.Organization, env.Repository, opts)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, page.WorkflowRuns...)
+		if resp.NextPage == 0 {
+			return runs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
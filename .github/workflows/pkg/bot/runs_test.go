@@ -0,0 +1,174 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/environment"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/githubtest"
+)
+
+func TestDismissRuns(t *testing.T) {
+	// run returns an in progress run of the Check workflow for pull
+	// request #1.
+	run := func(number int, event, sha string) githubtest.Run {
+		return githubtest.Run{
+			WorkflowID:   1,
+			Path:         ".github/workflows/check.yml",
+			Name:         "Check",
+			Event:        event,
+			HeadBranch:   "pr-1",
+			HeadSHA:      sha,
+			RunNumber:    number,
+			Status:       "in_progress",
+			PullRequests: []int{1},
+		}
+	}
+	// push returns an in progress run of the Check workflow for a push to
+	// master.
+	push := func(number int, sha string) githubtest.Run {
+		r := run(number, "push", sha)
+		r.HeadBranch, r.PullRequests = "master", nil
+		return r
+	}
+	tests := []struct {
+		desc string
+		runs []githubtest.Run
+		// trigger is the index of the run requested in a workflow_run
+		// event, or -1 for a scheduled sweep.
+		trigger int
+		// keepDefault keeps runs on the default branch.
+		keepDefault bool
+		cancelled   []int
+	}{
+		{
+			desc: "push supersedes an earlier push",
+			runs: []githubtest.Run{
+				run(1, "pull_request_target", "aaa111"),
+				run(2, "pull_request_target", "bbb222"),
+			},
+			trigger:   -1,
+			cancelled: []int{1},
+		},
+		{
+			desc: "review supersedes an earlier review",
+			runs: []githubtest.Run{
+				run(1, "pull_request_review", "aaa111"),
+				run(2, "pull_request_review", "aaa111"),
+			},
+			trigger:   -1,
+			cancelled: []int{1},
+		},
+		{
+			desc: "review does not supersede a push",
+			runs: []githubtest.Run{
+				run(1, "pull_request_target", "aaa111"),
+				run(2, "pull_request_review", "aaa111"),
+			},
+			trigger: -1,
+		},
+		{
+			desc: "requested review does not supersede a push",
+			runs: []githubtest.Run{
+				run(1, "pull_request_target", "aaa111"),
+				run(2, "pull_request_review", "aaa111"),
+			},
+			trigger: 1,
+		},
+		{
+			desc: "assignment does not supersede a push to the same commit",
+			runs: []githubtest.Run{
+				run(1, "pull_request_target", "aaa111"),
+				run(2, "pull_request_target", "bbb222"),
+				run(3, "pull_request_target", "bbb222"),
+			},
+			trigger:   2,
+			cancelled: []int{1},
+		},
+		{
+			desc: "push to the default branch supersedes an earlier push",
+			runs: []githubtest.Run{
+				push(1, "aaa111"),
+				push(2, "bbb222"),
+			},
+			trigger:   -1,
+			cancelled: []int{1},
+		},
+		{
+			desc: "pushes to the default branch are kept",
+			runs: []githubtest.Run{
+				push(1, "aaa111"),
+				push(2, "bbb222"),
+				run(3, "pull_request_target", "ccc333"),
+				run(4, "pull_request_target", "ddd444"),
+			},
+			trigger:     -1,
+			keepDefault: true,
+			cancelled:   []int{3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			srv := newTestServer(t)
+			// numbers maps run IDs to run numbers.
+			numbers := map[int64]int{}
+			ids := make([]int64, len(tt.runs))
+			for i, r := range tt.runs {
+				ids[i] = srv.AddRun(r)
+				numbers[ids[i]] = r.RunNumber
+			}
+
+			env := &environment.Environment{EventName: "schedule", Organization: testOwner, Repository: testRepo}
+			if tt.trigger >= 0 {
+				r := tt.runs[tt.trigger]
+				payload, err := json.Marshal(&github.WorkflowRunEvent{
+					Action: github.String("requested"),
+					WorkflowRun: &github.WorkflowRun{
+						ID:           github.Int64(ids[tt.trigger]),
+						WorkflowID:   github.Int64(r.WorkflowID),
+						Name:         github.String(r.Name),
+						Event:        github.String(r.Event),
+						HeadBranch:   github.String(r.HeadBranch),
+						HeadSHA:      github.String(r.HeadSHA),
+						RunNumber:    github.Int(r.RunNumber),
+						Status:       github.String(r.Status),
+						PullRequests: []*github.PullRequest{{Number: github.Int(1)}},
+					},
+					Repo: &github.Repository{
+						Name:     github.String(testRepo),
+						FullName: github.String(testOwner + "/" + testRepo),
+						Owner:    &github.User{Login: github.String(testOwner)},
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if env, err = environment.Parse("workflow_run", payload); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			b := newEventBot(t, srv, env, "")
+			b.c.KeepDefaultBranch = tt.keepDefault
+			if err := b.DismissRuns(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			var cancelled []int
+			for _, r := range srv.Runs() {
+				if r.Conclusion == "cancelled" {
+					cancelled = append(cancelled, numbers[r.ID])
+				}
+			}
+			if len(cancelled) != len(tt.cancelled) {
+				t.Fatalf("cancelled runs %v, want %v", cancelled, tt.cancelled)
+			}
+			for i := range cancelled {
+				if cancelled[i] != tt.cancelled[i] {
+					t.Fatalf("cancelled runs %v, want %v", cancelled, tt.cancelled)
+				}
+			}
+		})
+	}
+}
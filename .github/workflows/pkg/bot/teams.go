@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+)
+
+// teamMembers returns the logins of the members of team org/slug. Results
+// are cached for the lifetime of the bot.
+func (b *Bot) teamMembers(ctx context.Context, org, slug string) ([]string, error) {
+	key := strings.ToLower(org + "/" + slug)
+	if members, ok := b.teams[key]; ok {
+		return members, nil
+	}
+	var members []string
+	opts := &github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := b.c.GitHub.Teams.ListTeamMembersBySlug(ctx, org, slug, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range page {
+			members = append(members, u.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	b.teams[key] = members
+	return members, nil
+}
+
+// isTeamMember returns a membership check for "@org/team" references.
+// Lookup failures are treated as non-membership.
+func (b *Bot) isTeamMember(ctx context.Context) func(org, slug, user string) bool {
+	return func(org, slug, user string) bool {
+		members, err := b.teamMembers(ctx, org, slug)
+		if err != nil {
+			return false
+		}
+		for _, m := range members {
+			if strings.EqualFold(m, user) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// expand resolves reviewers, logins or "@org/team" references, into
+// individual logins, leaving out the pull request author and duplicates.
+func (b *Bot) expand(ctx context.Context, reviewers []string) ([]string, error) {
+	var logins []string
+	seen := map[string]bool{strings.ToLower(b.c.Environment.Author): true}
+	add := func(login string) {
+		if !seen[strings.ToLower(login)] {
+			seen[strings.ToLower(login)] = true
+			logins = append(logins, login)
+		}
+	}
+	for _, r := range reviewers {
+		org, slug, ok := config.ParseTeam(r)
+		if !ok {
+			add(r)
+			continue
+		}
+		members, err := b.teamMembers(ctx, org, slug)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			add(m)
+		}
+	}
+	return logins, nil
+}
+
+// teamReviewers returns the reviewers of pool p split into individual
+// logins, excluding the author, and team references.
+func (b *Bot) teamReviewers(p config.Pool) (users []string, teams []string) {
+	for _, r := range p.Reviewers {
+		if _, _, ok := config.ParseTeam(r); ok {
+			teams = append(teams, r)
+		} else if !strings.EqualFold(r, b.c.Environment.Author) {
+			users = append(users, r)
+		}
+	}
+	return users, teams
+}
@@ -0,0 +1,255 @@
+// Package cassette records GitHub API exchanges to fixture files and
+// replays them, so that the bot can be run offline against real responses.
+//
+// Recorded exchanges are sanitized: request headers, including
+// Authorization, are not stored, only a few response headers are kept, and
+// tokens and email addresses in URLs and bodies are redacted. Emails are
+// replaced by stable placeholders so that distinct addresses stay distinct.
+//
+// When replaying, each request is answered by the first unused exchange
+// with the same method, path, query and body. Requests without one fail.
+// Timestamps in request bodies, such as a check run's completion time, are
+// masked so that they match across runs.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// keptHeaders are the response headers stored in cassettes.
+var keptHeaders = []string{
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+	"Link",
+	"Retry-After",
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+}
+
+// Interaction is a recorded exchange.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string `json:"method"`
+	// URL is the path and sorted query, without scheme and host, so that
+	// cassettes replay against any base URL.
+	URL  string `json:"url"`
+	Body string `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+}
+
+// Cassette is an http.RoundTripper that records or replays exchanges.
+type Cassette struct {
+	path string
+	// next sends requests while recording. It is nil when replaying.
+	next http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder returns a cassette sending requests through next and
+// recording them, to be written to path by Save.
+func NewRecorder(path string, next http.RoundTripper) *Cassette {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Cassette{path: path, next: next}
+}
+
+// Load returns a cassette replaying the exchanges recorded in path.
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []*Interaction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		return nil, fmt.Errorf("invalid cassette %v: %v", path, err)
+	}
+	return &Cassette{path: path, interactions: interactions, used: make([]bool, len(interactions))}, nil
+}
+
+// RoundTrip records or replays an exchange.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	recorded := Request{Method: req.Method, URL: sanitize(requestURL(req)), Body: sanitize(maskTimes(string(body)))}
+	if c.next == nil {
+		return c.replay(req, recorded)
+	}
+
+	r := req.Clone(req.Context())
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp, err := c.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	headers := map[string]string{}
+	for _, h := range keptHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			headers[h] = sanitize(v)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, &Interaction{
+		Request:  recorded,
+		Response: Response{StatusCode: resp.StatusCode, Headers: headers, Body: sanitizeBody(respBody)},
+	})
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.interactions {
+		if c.used[i] || in.Request != recorded {
+			continue
+		}
+		c.used[i] = true
+		header := http.Header{}
+		for k, v := range in.Response.Headers {
+			header.Set(k, v)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%v %v", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %v has no recording of %v %v", c.path, recorded.Method, recorded.URL)
+}
+
+// Save writes the recorded exchanges to the cassette's path.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, append(data, '\n'), 0644)
+}
+
+// Unused returns the recorded exchanges not replayed yet, to check that a
+// replay made every request it was expected to.
+func (c *Cassette) Unused() []Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var unused []Request
+	for i, in := range c.interactions {
+		if !c.used[i] {
+			unused = append(unused, in.Request)
+		}
+	}
+	return unused
+}
+
+// requestURL returns the path and sorted query of req. The "/api/v3"
+// prefix of GitHub Enterprise is dropped.
+func requestURL(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, "/api/v3")
+	query := req.URL.Query()
+	if len(query) == 0 {
+		return path
+	}
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+var (
+	tokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	timePattern  = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+)
+
+// maskTimes replaces RFC 3339 timestamps in a request body.
+func maskTimes(s string) string {
+	return timePattern.ReplaceAllString(s, "TIMESTAMP")
+}
+
+// sanitizeBody redacts a response body, including base64 encoded file
+// contents such as CODEOWNERS files listing emails.
+func sanitizeBody(body []byte) string {
+	var content map[string]interface{}
+	if json.Unmarshal(body, &content) != nil || content["encoding"] != "base64" {
+		return sanitize(string(body))
+	}
+	encoded, _ := content["content"].(string)
+	decoded, err := base64.StdEncoding.DecodeString(strings.Replace(encoded, "\n", "", -1))
+	if err != nil {
+		return sanitize(string(body))
+	}
+	content["content"] = base64.StdEncoding.EncodeToString([]byte(sanitize(string(decoded))))
+	sanitized, err := json.Marshal(content)
+	if err != nil {
+		return sanitize(string(body))
+	}
+	return sanitize(string(sanitized))
+}
+
+// sanitize redacts tokens and email addresses in s.
+func sanitize(s string) string {
+	s = tokenPattern.ReplaceAllString(s, "REDACTED")
+	return emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		// Replayed requests may carry placeholders from recorded responses.
+		if strings.HasPrefix(email, "redacted-") && strings.HasSuffix(email, "@example.com") {
+			return email
+		}
+		sum := sha256.Sum256([]byte(strings.ToLower(email)))
+		return fmt.Sprintf("redacted-%x@example.com", sum[:4])
+	})
+}
@@ -0,0 +1,101 @@
+package cassette_test
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/bot"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/cassette"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/client"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/environment"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/githubtest"
+)
+
+var record = flag.Bool("record", false, "re-record the cassettes in testdata against the githubtest fake")
+
+const reviewers = `
+defaults:
+  reviewers: [alice, bob]
+contributors:
+  external:
+    approvals: 2
+`
+
+// TestReplay handles a push to a pull request from an external contributor
+// after it was approved, as recorded in testdata. With -record, the
+// payload and cassette are recorded against the fake instead.
+func TestReplay(t *testing.T) {
+	payloadPath := filepath.Join("testdata", "synchronize.json")
+	cassettePath := filepath.Join("testdata", "synchronize.cassette.json")
+
+	var (
+		tape    *cassette.Cassette
+		baseURL = "https://github.invalid/api/v3/"
+		err     error
+	)
+	if *record {
+		srv := githubtest.NewServer("gravitational", "teleport")
+		defer srv.Close()
+		srv.AddMember("alice")
+		srv.AddMember("bob")
+		srv.AddPullRequest(githubtest.PullRequest{
+			Number:  1,
+			Author:  "eve",
+			Fork:    "eve",
+			Files:   []string{"lib/auth.go"},
+			Commits: []githubtest.Commit{{SHA: "aaa111", Committer: "eve", Verified: true}},
+		})
+		srv.Submit(1, "alice", "APPROVED")
+		srv.Submit(1, "bob", "APPROVED")
+		srv.Push(1, githubtest.Commit{SHA: "bbb222", Committer: "eve", Verified: true})
+		payload, err := srv.PullRequestEvent("synchronize", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(payloadPath, payload, 0644); err != nil {
+			t.Fatal(err)
+		}
+		tape, baseURL = cassette.NewRecorder(cassettePath, nil), srv.URL
+	} else if tape, err = cassette.Load(cassettePath); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := ioutil.ReadFile(payloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := environment.Parse("pull_request_target", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh, err := client.New(client.Config{BaseURL: baseURL, Transport: tape})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := config.Parse([]byte(reviewers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := bot.New(bot.Config{GitHub: gh, Environment: env, Reviewers: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Requests missing from the cassette fail the run.
+	if err := b.Handle(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if *record {
+		if err := tape.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	for _, r := range tape.Unused() {
+		t.Errorf("request not made: %v %v", r.Method, r.URL)
+	}
+}
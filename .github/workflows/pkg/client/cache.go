@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cachedHeaders are the response headers stored with cached responses.
+var cachedHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Link"}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	URL          string            `json:"url"`
+	ETag         string            `json:"etag,omitempty"`
+	LastModified string            `json:"last_modified,omitempty"`
+	Header       map[string]string `json:"header"`
+	Body         []byte            `json:"body"`
+}
+
+// cacheTransport makes GET requests conditional on the ETag or
+// Last-Modified date of the response cached for the URL, and serves the
+// cached response when GitHub answers "304 Not Modified". Such answers do
+// not count against the rate limit.
+//
+// Entries are not keyed by token, since workflows get a new token every
+// run. Serving them is still safe: GitHub only answers 304 if the response
+// for the requesting token is unchanged.
+type cacheTransport struct {
+	dir    string
+	next   http.RoundTripper
+	budget *Budget
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+	path := t.path(req)
+	entry, err := t.load(path)
+	if err != nil {
+		log.Printf("Ignoring unreadable cache entry for %v: %v.", req.URL, err)
+	}
+	if entry != nil {
+		r := req.Clone(req.Context())
+		if entry.ETag != "" {
+			r.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			r.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+		req = r
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		t.budget.hit()
+		return entry.response(req, resp), nil
+	}
+	if resp.StatusCode != http.StatusOK || (resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "") {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	entry = &cacheEntry{
+		URL:          req.URL.String(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Header:       map[string]string{},
+		Body:         body,
+	}
+	for _, h := range cachedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			entry.Header[h] = v
+		}
+	}
+	if err := t.store(path, entry); err != nil {
+		log.Printf("Failed to cache %v: %v.", req.URL, err)
+	}
+	return resp, nil
+}
+
+// response returns the cached response, with the rate limit headers of
+// the "304 Not Modified" answer.
+func (e *cacheEntry) response(req *http.Request, notModified *http.Response) *http.Response {
+	header := http.Header{}
+	for k, v := range e.Header {
+		header.Set(k, v)
+	}
+	for k, v := range notModified.Header {
+		if strings.HasPrefix(k, "X-Ratelimit-") {
+			header[k] = v
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// path returns the cache file of a request, keyed by its URL and accepted
+// media type.
+func (t *cacheTransport) path(req *http.Request) string {
+	key := fmt.Sprintf("%v\n%v", req.URL, req.Header.Get("Accept"))
+	return filepath.Join(t.dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(key))))
+}
+
+func (t *cacheTransport) load(path string) (*cacheEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// store writes an entry atomically, since concurrent requests may cache
+// the same URL.
+func (t *cacheTransport) store(path string, e *cacheEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(t.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
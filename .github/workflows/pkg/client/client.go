@@ -0,0 +1,102 @@
+// Package client builds the go-github client used by the bot.
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// Config configures the client.
+type Config struct {
+	// Token authenticates requests. If empty, the client is unauthenticated
+	// and limited to public data and the anonymous rate limit.
+	Token string
+	// BaseURL is the API root, e.g. "https://github.example.com/api/v3/"
+	// for GitHub Enterprise or the URL of a githubtest fake. It defaults to
+	// "https://api.github.com/".
+	BaseURL string
+	// Transport sends requests, e.g. a cassette. It defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// CacheDir is the directory GET responses are cached in to make
+	// conditional requests. Caching is disabled if empty.
+	CacheDir string
+	// MaxWait is the longest the client waits for a rate limit to reset
+	// before failing the request. It defaults to 10 minutes.
+	MaxWait time.Duration
+	// Budget tracks rate limits and requests. It is allocated if nil.
+	Budget *Budget
+	// DryRun records requests that would change state in Plan instead of
+	// sending them.
+	DryRun bool
+	// Plan collects the requests skipped by a dry run. It is allocated if
+	// nil.
+	Plan *Plan
+}
+
+// CheckAndSetDefaults verifies the configuration.
+func (c *Config) CheckAndSetDefaults() error {
+	if c.MaxWait == 0 {
+		c.MaxWait = 10 * time.Minute
+	}
+	if c.Budget == nil {
+		c.Budget = &Budget{}
+	}
+	if c.DryRun && c.Plan == nil {
+		c.Plan = &Plan{}
+	}
+	return nil
+}
+
+// New returns a GitHub client.
+func New(c Config) (*github.Client, error) {
+	if err := c.CheckAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	transport = &rateLimitTransport{next: transport, maxWait: c.MaxWait, budget: c.Budget}
+	if c.CacheDir != "" {
+		if err := os.MkdirAll(c.CacheDir, 0700); err != nil {
+			return nil, err
+		}
+		transport = &cacheTransport{dir: c.CacheDir, next: transport, budget: c.Budget}
+	}
+	if c.Token != "" {
+		transport = &tokenTransport{token: c.Token, next: transport}
+	}
+	if c.DryRun {
+		transport = &dryRunTransport{plan: c.Plan, next: transport}
+	}
+	gh := github.NewClient(&http.Client{Transport: transport})
+	if c.BaseURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(c.BaseURL, "/") + "/")
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL: %v", err)
+		}
+		gh.BaseURL, gh.UploadURL = u, u
+	}
+	return gh, nil
+}
+
+// tokenTransport authenticates requests with a personal access or
+// installation token.
+type tokenTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given.
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "token "+t.token)
+	return t.next.RoundTrip(r)
+}
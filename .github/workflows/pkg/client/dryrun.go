@@ -0,0 +1,153 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Plan records the requests that would change state in a dry run.
+type Plan struct {
+	mu    sync.Mutex
+	Steps []Step `json:"steps"`
+}
+
+// Step is a request that would change state.
+type Step struct {
+	// Operation names the operation, e.g. "request_reviewers", or is empty
+	// for endpoints the bot does not normally call.
+	Operation string `json:"operation,omitempty"`
+	// Method is the HTTP method.
+	Method string `json:"method"`
+	// Path is the API path, e.g. "/repos/o/r/pulls/1/requested_reviewers".
+	Path string `json:"path"`
+	// Body is the request body, if any.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Write writes the plan as indented JSON.
+func (p *Plan) Write(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+func (p *Plan) add(s Step) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Steps = append(p.Steps, s)
+	return len(p.Steps)
+}
+
+// operations names the mutating endpoints the bot uses.
+var operations = []struct {
+	method string
+	path   *regexp.Regexp
+	name   string
+}{
+	{"POST", regexp.MustCompile(`^/repos/[^/]+/[^/]+/pulls/\d+/requested_reviewers$`), "request_reviewers"},
+	{"DELETE", regexp.MustCompile(`^/repos/[^/]+/[^/]+/pulls/\d+/requested_reviewers$`), "remove_reviewers"},
+	{"PUT", regexp.MustCompile(`^/repos/[^/]+/[^/]+/pulls/\d+/reviews/\d+/dismissals$`), "dismiss_review"},
+	{"POST", regexp.MustCompile(`^/repos/[^/]+/[^/]+/actions/runs/\d+/cancel$`), "cancel_run"},
+	{"POST", regexp.MustCompile(`^/repos/[^/]+/[^/]+/actions/runs/\d+/rerun$`), "rerun_run"},
+	{"POST", regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues/\d+/comments$`), "create_comment"},
+	{"PATCH", regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues/comments/\d+$`), "edit_comment"},
+	{"DELETE", regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues/comments/\d+$`), "delete_comment"},
+	{"POST", regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues$`), "create_issue"},
+	{"PATCH", regexp.MustCompile(`^/repos/[^/]+/[^/]+/issues/\d+$`), "edit_issue"},
+	{"POST", regexp.MustCompile(`^/repos/[^/]+/[^/]+/check-runs$`), "create_check_run"},
+	{"PATCH", regexp.MustCompile(`^/repos/[^/]+/[^/]+/check-runs/\d+$`), "update_check_run"},
+}
+
+func operation(method, path string) string {
+	for _, op := range operations {
+		if op.method == method && op.path.MatchString(path) {
+			return op.name
+		}
+	}
+	return ""
+}
+
+// dryRunTransport sends read requests and records the others in a plan,
+// answering them with a synthetic response so that the bot carries on as if
+// they had succeeded.
+type dryRunTransport struct {
+	plan *Plan
+	next http.RoundTripper
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !mutates(req) {
+		return t.next.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	body = bytes.TrimSpace(body)
+	step := Step{
+		Operation: operation(req.Method, req.URL.Path),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+	}
+	if json.Valid(body) {
+		step.Body = body
+	}
+	n := t.plan.add(step)
+	log.Printf("Dry run: would %v %v %s", req.Method, req.URL.Path, body)
+	return synthesize(req, body, n), nil
+}
+
+// synthesize returns a response to a mutating request: "204 No Content"
+// for deletions and otherwise the request body echoed back as the resource,
+// with a made-up ID.
+func synthesize(req *http.Request, body []byte, n int) *http.Response {
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Request:    req,
+	}
+	if req.Method == http.MethodDelete {
+		resp.Status, resp.StatusCode = "204 No Content", http.StatusNoContent
+		resp.Body = ioutil.NopCloser(strings.NewReader(""))
+		return resp
+	}
+	if req.Method == http.MethodPost {
+		resp.Status, resp.StatusCode = "201 Created", http.StatusCreated
+	}
+	resource := map[string]interface{}{}
+	json.Unmarshal(body, &resource)
+	if _, ok := resource["id"]; !ok {
+		resource["id"] = n
+	}
+	data, _ := json.Marshal(resource)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	return resp
+}
+
+// mutates reports whether req changes state. GraphQL requests are POSTs but
+// the bot only sends queries through them.
+func mutates(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !strings.HasSuffix(req.URL.Path, "/graphql")
+}
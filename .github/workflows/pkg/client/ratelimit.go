@@ -0,0 +1,232 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+const (
+	// serverErrorRetries is how often requests failing with a 5xx status
+	// are retried.
+	serverErrorRetries = 3
+	// serverErrorDelay is the delay before the first retry of a 5xx
+	// status. It doubles with every retry.
+	serverErrorDelay = time.Second
+	// abuseRetries is how often requests hitting the secondary rate limit
+	// are retried.
+	abuseRetries = 3
+	// abuseDelay is the delay after hitting the secondary rate limit if
+	// GitHub does not say how long to wait.
+	abuseDelay = time.Minute
+)
+
+// Budget tracks the rate limits reported by GitHub and the number of
+// requests made, per rate limit resource such as "core" or "search".
+type Budget struct {
+	mu        sync.Mutex
+	rates     map[string]github.Rate
+	requests  map[string]int
+	cached    int
+	throttled time.Duration
+}
+
+func (b *Budget) observe(resp *http.Response) {
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rates == nil {
+		b.rates, b.requests = map[string]github.Rate{}, map[string]int{}
+	}
+	b.requests[resource]++
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	b.rates[resource] = github.Rate{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     github.Timestamp{Time: time.Unix(reset, 0)},
+	}
+}
+
+func (b *Budget) hit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cached++
+}
+
+func (b *Budget) wait(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.throttled += d
+}
+
+// String summarizes the budget, e.g. "core: 112 requests, 4853/5000
+// remaining until 15:04:05".
+func (b *Budget) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var resources []string
+	for r := range b.requests {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+	var parts []string
+	for _, r := range resources {
+		part := fmt.Sprintf("%v: %v requests", r, b.requests[r])
+		if rate, ok := b.rates[r]; ok {
+			part += fmt.Sprintf(", %v/%v remaining until %v", rate.Remaining, rate.Limit, rate.Reset.Format("15:04:05"))
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "no requests"
+	}
+	summary := strings.Join(parts, "; ")
+	if b.cached > 0 {
+		summary += fmt.Sprintf("; %v served from cache", b.cached)
+	}
+	if b.throttled > 0 {
+		summary += fmt.Sprintf("; waited %v for rate limits", b.throttled.Round(time.Second))
+	}
+	return summary
+}
+
+// rateLimitTransport waits out rate limits and retries server errors.
+//
+// Requests exceeding the primary rate limit wait for the limit to reset
+// and requests hitting the secondary rate limit wait as long as GitHub
+// asks, as long as that is at most maxWait. Otherwise the error response
+// is returned and go-github turns it into a *github.RateLimitError or
+// *github.AbuseRateLimitError. Server errors of idempotent requests are
+// retried with exponential backoff and jitter. Other requests, such as
+// creating a comment, may have taken effect despite the error, so retrying
+// them could apply them twice.
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	maxWait time.Duration
+	budget  *Budget
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	serverErrors, abuses := 0, 0
+	for {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		t.budget.observe(resp)
+
+		var wait time.Duration
+		switch {
+		case resp.StatusCode >= 500 && idempotent(req.Method) && serverErrors < serverErrorRetries:
+			wait = serverErrorDelay << uint(serverErrors)
+			wait += time.Duration(rand.Int63n(int64(wait)))
+			serverErrors++
+			log.Printf("%v %v failed with %v, retrying in %v.", req.Method, req.URL.Path, resp.Status, wait.Round(time.Millisecond))
+		case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+			body, rerr := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if rerr != nil {
+				return nil, rerr
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			// CheckResponse consumes the body of the copy it is given.
+			check := *resp
+			check.Body = ioutil.NopCloser(bytes.NewReader(body))
+			err := github.CheckResponse(&check)
+			if e, ok := err.(*github.RateLimitError); ok {
+				wait = time.Until(e.Rate.Reset.Time) + time.Second
+				log.Printf("Rate limit of %v requests exhausted until %v.", e.Rate.Limit, e.Rate.Reset.Format("15:04:05"))
+			} else if retryAfter, ok := secondaryRateLimit(resp, err); ok {
+				if abuses >= abuseRetries {
+					return resp, nil
+				}
+				abuses++
+				wait = retryAfter
+				log.Printf("Secondary rate limit hit on %v %v, retrying in %v.", req.Method, req.URL.Path, wait)
+			} else {
+				return resp, nil
+			}
+			if wait > t.maxWait {
+				log.Printf("Not waiting %v for the rate limit, the maximum is %v.", wait.Round(time.Second), t.maxWait)
+				return resp, nil
+			}
+		default:
+			return resp, nil
+		}
+
+		// Retrying needs a fresh copy of the request body.
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		t.budget.wait(wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// idempotent reports whether requests with method can be repeated without
+// changing their effect.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// secondaryRateLimit reports whether err, returned by github.CheckResponse
+// for resp, is caused by the secondary rate limit and how long to wait.
+// go-github only recognizes the limit by its former documentation URL, so
+// the message and Retry-After header are checked too.
+func secondaryRateLimit(resp *http.Response, err error) (time.Duration, bool) {
+	var wait time.Duration
+	if seconds, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+		wait = time.Duration(seconds) * time.Second
+	}
+	switch e := err.(type) {
+	case *github.AbuseRateLimitError:
+		wait = e.GetRetryAfter()
+	case *github.ErrorResponse:
+		if !strings.Contains(strings.ToLower(e.Message), "secondary rate limit") && wait == 0 {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if wait == 0 {
+		wait = abuseDelay
+	}
+	return wait, true
+}
@@ -1,78 +1,556 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/availability"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/bot"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/cassette"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/client"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/config"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/environment"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/flaky"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/queue"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/server"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/usage"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/verify"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/workflow"
 )
 
+const usageText = `usage: main [flags] <command>
+
+commands:
+  assign-reviewers  request reviews from the pools and code owners of the changed files
+  check-reviewers   report whether every owning pool and code owner has approved
+                    as the "Review gate" check run
+  dismiss-runs      cancel workflow runs superseded by a newer run for the same
+                    pull request or branch; on a workflow_run event, only
+                    those superseded by the run requested
+  rerun-check       on the workflow_run event for a review of a pull request from
+                    a fork, re-run the review gate with a write token
+  validate-config   check the configuration and that its users and teams exist
+  lint-workflows    check the workflows in --workflows against the security
+                    baseline in the configuration
+  validate-workflows
+                    check the workflows in --workflows against the workflow
+                    syntax and preview their schedules
+  pin-actions       report actions in --workflows not pinned to a commit SHA;
+                    with --fix, pin them to the commit their tag or branch
+                    points at
+  usage             report the Actions minutes used by the workflows in --workflows
+                    over the last --days, by workflow, event and day, compared
+                    with the period before, as --format table, csv or json
+  flaky             report jobs of the workflows in --workflows that failed and then
+                    passed on the same commit over the last --days, as --format
+                    table, csv or json; with --issues, open or update a
+                    tracking issue per flaky job
+  replay            handle the event in --payload as the workflows would, e.g.
+                    replay --event pull_request_review --payload event.json --dry-run
+  serve             receive webhook deliveries, queue them in --queue-dir and handle
+                    them like the workflows do, retrying failed deliveries
+
+With no command, the signature of a fixed commit is verified with gpg.
+
+flags:
+`
+
+type flags struct {
+	token       string
+	apiURL      string
+	configPath  string
+	workflows   string
+	fix         bool
+	repo        string
+	days        int
+	format      string
+	issues      bool
+	listen      string
+	secret      string
+	queueDir    string
+	event       string
+	payload     string
+	dryRun      bool
+	planPath    string
+	cacheDir    string
+	graphql     bool
+	keepDefault bool
+	cassette    string
+	record      bool
+	command     string
+
+	// plan collects the requests skipped in a dry run.
+	plan *client.Plan
+	// budget tracks the API rate limits.
+	budget *client.Budget
+	// online is set once a GitHub client is built. Commands that work
+	// offline have no API budget to report.
+	online *bool
+	// tape records or replays API exchanges if --cassette is set.
+	tape *cassette.Cassette
+}
+
+func parseFlags() flags {
+	var f flags
+	flag.StringVar(&f.token, "token", "", "GitHub API token")
+	flag.StringVar(&f.apiURL, "api-url", "", "GitHub API root (default https://api.github.com/)")
+	flag.StringVar(&f.configPath, "config", config.DefaultPath, "path to the review bot configuration")
+	flag.StringVar(&f.workflows, "workflows", ".github/workflows", "directory of the workflows to lint")
+	flag.BoolVar(&f.fix, "fix", false, "rewrite unpinned actions to commit SHAs (pin-actions)")
+	flag.StringVar(&f.repo, "repo", os.Getenv("GITHUB_REPOSITORY"), "repository to report on as owner/name (default $GITHUB_REPOSITORY)")
+	flag.IntVar(&f.days, "days", 0, "number of days to report on; defaults to 7 for usage and 14 for flaky")
+	flag.StringVar(&f.format, "format", usage.FormatTable, "report format: table, csv or json (usage, flaky)")
+	flag.BoolVar(&f.issues, "issues", false, "open or update a tracking issue per flaky job (flaky)")
+	flag.StringVar(&f.listen, "listen", ":8080", "address to serve webhooks on")
+	flag.StringVar(&f.secret, "webhook-secret", os.Getenv("WEBHOOK_SECRET"), "webhook secret shared with GitHub (default $WEBHOOK_SECRET)")
+	flag.StringVar(&f.queueDir, "queue-dir", "review-bot-queue", "directory webhook deliveries are queued in")
+	flag.StringVar(&f.event, "event", "", "name of the event to replay, e.g. pull_request_review")
+	flag.StringVar(&f.payload, "payload", "", "path to the event payload to replay")
+	flag.BoolVar(&f.dryRun, "dry-run", false, "record requests that would change state as a plan instead of sending them")
+	flag.StringVar(&f.planPath, "plan", "", "file to write the dry-run plan to as JSON (default stdout)")
+	flag.StringVar(&f.cacheDir, "cache-dir", "", "directory to cache API responses in for conditional requests")
+	flag.BoolVar(&f.graphql, "graphql", false, "fetch pull request files, commits and reviews in batched GraphQL queries")
+	flag.BoolVar(&f.keepDefault, "keep-default-branch", false, "never cancel runs on the default branch (dismiss-runs)")
+	flag.StringVar(&f.cassette, "cassette", "", "replay API responses from this cassette instead of calling GitHub")
+	flag.BoolVar(&f.record, "record", false, "call GitHub and record the sanitized exchanges to --cassette")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usageText)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	f.command = flag.Arg(0)
+	// Flags may also follow the command.
+	if flag.NArg() > 1 {
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	if f.dryRun {
+		f.plan = &client.Plan{}
+	}
+	f.budget = &client.Budget{}
+	f.online = new(bool)
+	return f
+}
+
 func main() {
-	err := verifySig()
+	f := parseFlags()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var err error
+	if f.cassette != "" {
+		if f.record {
+			f.tape = cassette.NewRecorder(f.cassette, nil)
+		} else if f.tape, err = cassette.Load(f.cassette); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch f.command {
+	case "":
+		err = verifySig(ctx, f)
+	case "validate-config":
+		err = validateConfig(ctx, f)
+	case "lint-workflows":
+		err = lintWorkflows(f)
+	case "validate-workflows":
+		err = validateWorkflows(f)
+	case "pin-actions":
+		err = pinActions(ctx, f)
+	case "assign-reviewers", "check-reviewers", "dismiss-runs", "rerun-check":
+		err = runBot(ctx, f)
+	case "serve":
+		err = serve(ctx, f)
+	case "usage":
+		err = reportUsage(ctx, f)
+	case "flaky":
+		err = findFlaky(ctx, f)
+	case "replay":
+		err = replay(ctx, f)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	// The plan is written even if the command failed, to show how far it
+	// got.
+	if f.plan != nil {
+		if perr := writePlan(f); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	if *f.online {
+		log.Printf("GitHub API budget: %v.", f.budget)
+	}
+	if f.record && f.tape != nil {
+		if serr := f.tape.Save(); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	// A replay that skipped recorded requests no longer does what was
+	// recorded.
+	if !f.record && f.tape != nil && err == nil {
+		if unused := f.tape.Unused(); len(unused) != 0 {
+			for _, r := range unused {
+				log.Printf("Recorded request not made: %v %v.", r.Method, r.URL)
+			}
+			err = fmt.Errorf("%v of the requests recorded in %v were not made", len(unused), f.cassette)
+		}
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func verifySig() error {
-	client := github.NewClient(nil)
-	commit, _, err := client.Repositories.GetCommit(context.TODO(), "gravitational", "teleport", "f4ee52191cce728dd19ddd34c72bbe8858a281db") //api request
+// writePlan writes the requests skipped in a dry run to --plan or stdout.
+func writePlan(f flags) error {
+	if f.planPath == "" {
+		return f.plan.Write(os.Stdout)
+	}
+	out, err := os.Create(f.planPath)
 	if err != nil {
 		return err
 	}
+	if err := f.plan.Write(out); err != nil {
+		out.Close()
+		return err
+	}
+	log.Printf("Wrote %v planned changes to %v.", len(f.plan.Steps), f.planPath)
+	return out.Close()
+}
 
-	signature := *commit.Commit.Verification.Signature
-	payloadData := *commit.Commit.Verification.Payload
+func validateConfig(ctx context.Context, f flags) error {
+	c, err := config.Load(f.configPath)
+	if err != nil {
+		return err
+	}
+	if path := c.Availability.Calendar; path != "" {
+		if _, err := availability.Load(path); err != nil {
+			return err
+		}
+	}
+	gh, err := newClient(f)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(ctx, gh); err != nil {
+		return err
+	}
+	log.Printf("%v is valid.", f.configPath)
+	return nil
+}
 
-	// creating file
-	dataFile, err := ioutil.TempFile(".", "data")
+// lintWorkflows reports workflows that break the security baseline.
+func lintWorkflows(f flags) error {
+	c, err := config.Load(f.configPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	files, err := workflow.LoadDir(f.workflows)
+	if err != nil {
+		return err
+	}
+	policy := workflow.Policy{
+		DefaultBranch: c.Workflows.DefaultBranch,
+		Permissions:   c.Workflows.Permissions,
 	}
-	// Remember to clean up the file afterwards
-	defer os.Remove(dataFile.Name())
+	var problems int
+	for _, file := range files {
+		for _, p := range workflow.Lint(file, policy) {
+			fmt.Println(p)
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("found %v problems in %v workflows", problems, len(files))
+	}
+	log.Printf("%v workflows follow the baseline.", len(files))
+	return nil
+}
 
-	// Example writing to the file
-	dataText := []byte(payloadData)
-	if _, err = dataFile.Write(dataText); err != nil {
-		log.Fatal("Failed to write to temporary file", err)
+// validateWorkflows reports workflows with syntax errors and previews their
+// schedules.
+func validateWorkflows(f flags) error {
+	files, err := workflow.LoadDir(f.workflows)
+	if err != nil {
+		return err
+	}
+	var problems int
+	for _, file := range files {
+		for _, p := range workflow.Validate(file) {
+			fmt.Println(p)
+			problems++
+		}
+		for _, s := range file.Schedules() {
+			log.Printf("%v:%v: %q runs %v.", file.Path, s.Node.Line, s.Node.Value, s.Cron.Describe(time.Now()))
+		}
 	}
+	if problems > 0 {
+		return fmt.Errorf("found %v problems in %v workflows", problems, len(files))
+	}
+	log.Printf("%v workflows are valid.", len(files))
+	return nil
+}
 
-	// Close the file
-	if err := dataFile.Close(); err != nil {
-		log.Fatal(err)
+// pinActions reports unpinned actions or, with --fix, pins them.
+func pinActions(ctx context.Context, f flags) error {
+	files, err := workflow.LoadDir(f.workflows)
+	if err != nil {
+		return err
+	}
+	if !f.fix {
+		var problems int
+		for _, file := range files {
+			for _, p := range workflow.Unpinned(file) {
+				fmt.Println(p)
+				problems++
+			}
+		}
+		if problems > 0 {
+			return fmt.Errorf("found %v unpinned actions, run with --fix to pin them", problems)
+		}
+		return nil
+	}
+	gh, err := newClient(f)
+	if err != nil {
+		return err
+	}
+	resolve := workflow.NewResolver(gh)
+	for _, file := range files {
+		n, err := file.Pin(ctx, resolve)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if err := file.Save(); err != nil {
+			return err
+		}
+		log.Printf("Pinned %v actions in %v.", n, file.Path)
 	}
+	return nil
+}
 
-	// creating file
-	sigFile, err := ioutil.TempFile(".", "signature")
+// reportUsage writes the Actions usage of the workflows to stdout.
+func reportUsage(ctx context.Context, f flags) error {
+	owner, repo, err := splitRepo(f.repo)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	// Remember to clean up the file afterwards
-	defer os.Remove(sigFile.Name())
-	// Example writing to the file
-	signatureText := []byte(signature)
-	if _, err = sigFile.Write(signatureText); err != nil {
-		log.Fatal("Failed to write to temporary file", err)
+	files, err := workflow.LoadDir(f.workflows)
+	if err != nil {
+		return err
 	}
-	// Close the file
-	if err := sigFile.Close(); err != nil {
-		log.Fatal(err)
+	gh, err := newClient(f)
+	if err != nil {
+		return err
 	}
-	cmd := exec.Command("gpg", "--verify", sigFile.Name(), dataFile.Name())
-	var errout bytes.Buffer
-	cmd.Stderr = &errout
+	report, err := usage.Collect(ctx, usage.Config{
+		GitHub:       gh,
+		Organization: owner,
+		Repository:   repo,
+		Workflows:    workflowNames(files),
+		Days:         f.days,
+	})
+	if err != nil {
+		return err
+	}
+	return report.Write(os.Stdout, f.format)
+}
+
+// findFlaky reports flaky jobs and, with --issues, tracks them in issues.
+func findFlaky(ctx context.Context, f flags) error {
+	owner, repo, err := splitRepo(f.repo)
+	if err != nil {
+		return err
+	}
+	files, err := workflow.LoadDir(f.workflows)
+	if err != nil {
+		return err
+	}
+	gh, err := newClient(f)
+	if err != nil {
+		return err
+	}
+	report, err := flaky.Find(ctx, flaky.Config{
+		GitHub:       gh,
+		Organization: owner,
+		Repository:   repo,
+		Workflows:    workflowNames(files),
+		Days:         f.days,
+	})
+	if err != nil {
+		return err
+	}
+	if err := report.Write(os.Stdout, f.format); err != nil {
+		return err
+	}
+	if !f.issues {
+		return nil
+	}
+	return report.UpdateIssues(ctx, gh, owner, repo)
+}
+
+// workflowNames returns the file names of the workflows.
+func workflowNames(files []*workflow.File) []string {
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file.Path))
+	}
+	return names
+}
+
+// splitRepo splits an owner/name repository reference.
+func splitRepo(s string) (string, string, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("--repo must be owner/name, got %q", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// newClient returns the GitHub client configured by the flags.
+func newClient(f flags) (*github.Client, error) {
+	c := client.Config{
+		Token:    f.token,
+		BaseURL:  f.apiURL,
+		CacheDir: f.cacheDir,
+		Budget:   f.budget,
+		DryRun:   f.dryRun,
+		Plan:     f.plan,
+	}
+	if f.tape != nil {
+		c.Transport = f.tape
+	}
+	*f.online = true
+	return client.New(c)
+}
 
-	if err := cmd.Run(); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			log.Fatal(exitError.ExitCode())
+// loadBotConfig returns the bot configuration shared by every event. The
+// review policy is only loaded if needed by the command.
+func loadBotConfig(f flags, needReviewers bool) (bot.Config, error) {
+	gh, err := newClient(f)
+	if err != nil {
+		return bot.Config{}, err
+	}
+	c := bot.Config{GitHub: gh, GraphQL: f.graphql, KeepDefaultBranch: f.keepDefault}
+	if !needReviewers {
+		return c, nil
+	}
+	reviewers, err := config.Load(f.configPath)
+	if err != nil {
+		return bot.Config{}, err
+	}
+	c.Reviewers = reviewers
+	if path := reviewers.Availability.Calendar; path != "" {
+		if c.Calendar, err = availability.Load(path); err != nil {
+			return bot.Config{}, err
 		}
 	}
-	//fmt.Println(errout.String())
+	return c, nil
+}
 
-	return nil
+func runBot(ctx context.Context, f flags) error {
+	c, err := loadBotConfig(f, f.command != "dismiss-runs" && f.command != "rerun-check")
+	if err != nil {
+		return err
+	}
+	if c.Environment, err = environment.New(); err != nil {
+		return err
+	}
+	b, err := bot.New(c)
+	if err != nil {
+		return err
+	}
+	switch f.command {
+	case "assign-reviewers":
+		return b.Assign(ctx)
+	case "check-reviewers":
+		return b.Check(ctx)
+	case "dismiss-runs":
+		return b.DismissRuns(ctx)
+	case "rerun-check":
+		return b.RerunCheck(ctx)
+	}
+	return fmt.Errorf("unknown command %q", f.command)
+}
+
+func serve(ctx context.Context, f flags) error {
+	c, err := loadBotConfig(f, true)
+	if err != nil {
+		return err
+	}
+	q, err := queue.New(queue.Config{
+		Dir: f.queueDir,
+		Handler: func(ctx context.Context, d *queue.Delivery) error {
+			env, err := environment.Parse(d.Event, d.Payload)
+			if err != nil {
+				return err
+			}
+			log.Printf("Handling delivery %v: %v %v (attempt %v).", d.ID, d.Event, env.Action, d.Attempts)
+			c := c
+			c.Environment = env
+			b, err := bot.New(c)
+			if err != nil {
+				return err
+			}
+			return b.Handle(ctx)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	srv, err := server.New(server.Config{
+		Addr:   f.listen,
+		Secret: []byte(f.secret),
+		Queue:  q,
+	})
+	if err != nil {
+		return err
+	}
+	return srv.Run(ctx)
+}
+
+// replay handles a recorded event payload, such as the file at
+// GITHUB_EVENT_PATH or a webhook delivery, to reproduce the bot's behavior.
+func replay(ctx context.Context, f flags) error {
+	if f.event == "" || f.payload == "" {
+		return fmt.Errorf("replay needs --event and --payload")
+	}
+	payload, err := ioutil.ReadFile(f.payload)
+	if err != nil {
+		return err
+	}
+	c, err := loadBotConfig(f, true)
+	if err != nil {
+		return err
+	}
+	if c.Environment, err = environment.Parse(f.event, payload); err != nil {
+		return err
+	}
+	b, err := bot.New(c)
+	if err != nil {
+		return err
+	}
+	return b.Handle(ctx)
+}
+
+func verifySig(ctx context.Context, f flags) error {
+	gh, err := newClient(f)
+	if err != nil {
+		return err
+	}
+	commit, _, err := gh.Repositories.GetCommit(ctx, "gravitational", "teleport", "f4ee52191cce728dd19ddd34c72bbe8858a281db") //api request
+	if err != nil {
+		return err
+	}
+	return verify.Commit(commit)
 }
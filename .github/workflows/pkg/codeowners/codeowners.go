@@ -0,0 +1,194 @@
+// Package codeowners parses CODEOWNERS files.
+//
+// Matching follows GitHub's rules: patterns use gitignore syntax without
+// negation or character ranges, and the last matching pattern in the file
+// takes precedence. A pattern with no owners leaves matching paths unowned.
+package codeowners
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Locations are the paths GitHub reads a CODEOWNERS file from, in the
+// order they are searched.
+var Locations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// File is a parsed CODEOWNERS file.
+type File struct {
+	Rules []Rule
+}
+
+// Rule is a single pattern and its owners.
+type Rule struct {
+	// Pattern is the pattern as written in the file.
+	Pattern string
+	// Owners are "@user", "@org/team" or email owners.
+	Owners []string
+	// Line is the line number of the rule, starting at one.
+	Line int
+
+	re *regexp.Regexp
+}
+
+// Parse reads a CODEOWNERS file. Like GitHub, it skips lines with an
+// unsupported pattern and owners that are not valid, logging them, and
+// returns the remaining rules. A line left without any valid owner is
+// skipped rather than leaving its paths unowned.
+func Parse(r io.Reader) (*File, error) {
+	var f File
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		fields := splitLine(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		re, err := compile(fields[0])
+		if err != nil {
+			log.Printf("Skipping CODEOWNERS line %d: %v.", line, err)
+			continue
+		}
+		var owners []string
+		for _, owner := range fields[1:] {
+			if !validOwner(owner) {
+				log.Printf("Skipping invalid owner %q on CODEOWNERS line %d.", owner, line)
+				continue
+			}
+			owners = append(owners, owner)
+		}
+		if len(owners) == 0 && len(fields) > 1 {
+			log.Printf("Skipping CODEOWNERS line %d: no valid owners.", line)
+			continue
+		}
+		f.Rules = append(f.Rules, Rule{
+			Pattern: fields[0],
+			Owners:  owners,
+			Line:    line,
+			re:      re,
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Match returns the last rule matching path, or nil if no rule matches.
+func (f *File) Match(path string) *Rule {
+	path = strings.TrimPrefix(path, "/")
+	for i := len(f.Rules) - 1; i >= 0; i-- {
+		if f.Rules[i].re.MatchString(path) {
+			return &f.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Owners returns the owners of path. It returns nil for unowned paths.
+func (f *File) Owners(path string) []string {
+	if r := f.Match(path); r != nil {
+		return r.Owners
+	}
+	return nil
+}
+
+// IsTeam reports whether owner is an "@org/team" owner.
+func IsTeam(owner string) bool {
+	return strings.HasPrefix(owner, "@") && strings.Contains(owner, "/")
+}
+
+// IsEmail reports whether owner is an email owner.
+func IsEmail(owner string) bool {
+	return !strings.HasPrefix(owner, "@") && strings.Contains(owner, "@")
+}
+
+// splitLine strips comments and splits a line into its pattern and owners.
+// A "#" starts a comment unless it is escaped with a backslash.
+func splitLine(line string) []string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '#':
+			b.WriteByte('#')
+			i++
+		case line[i] == '#':
+			return strings.Fields(b.String())
+		default:
+			b.WriteByte(line[i])
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+var (
+	userOwner  = regexp.MustCompile(`^@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?$`)
+	teamOwner  = regexp.MustCompile(`^@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?/[A-Za-z0-9_.-]+$`)
+	emailOwner = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+func validOwner(owner string) bool {
+	return userOwner.MatchString(owner) || teamOwner.MatchString(owner) || emailOwner.MatchString(owner)
+}
+
+// compile converts a CODEOWNERS pattern to a regular expression matched
+// against slash separated paths relative to the repository root.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") {
+		return nil, fmt.Errorf("negated pattern %q is not supported", pattern)
+	}
+	if strings.ContainsAny(pattern, "[]") {
+		return nil, fmt.Errorf("character ranges in %q are not supported", pattern)
+	}
+
+	p := pattern
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	// A pattern containing a slash other than a trailing one is relative to
+	// the root. Otherwise it matches at any depth.
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		}
+	}
+	switch {
+	case dirOnly:
+		// "dir/" matches everything below dir, but not a file named dir.
+		b.WriteString("/.*")
+	case strings.HasSuffix(p, "/*"):
+		// "dir/*" matches the direct children of dir only.
+	default:
+		// Anything else matches the path itself or, if it is a directory,
+		// everything below it.
+		b.WriteString("(?:/.*)?")
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
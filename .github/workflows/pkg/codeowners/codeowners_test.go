@@ -0,0 +1,103 @@
+package codeowners
+
+import (
+	"strings"
+	"testing"
+)
+
+// testFile follows the example CODEOWNERS file in GitHub's documentation,
+// plus lines GitHub skips.
+const testFile = `# Comment lines and blank lines are ignored.
+
+* @global-owner
+*.js @js-owner #This is an inline comment.
+*.go docs@example.com
+/build/logs/ @doctocat
+docs/* docs@example.com
+apps/ @octocat
+/docs/ @doctocat
+/scripts/ @doctocat @octocat
+**/logs @octocat
+/apps/ @octocat
+/apps/github
+\#notes @escaped
+
+# Unsupported patterns are skipped.
+!*.md @negated
+[Rr]eadme @ranged
+# Lines without a valid owner are skipped, invalid owners are dropped.
+*.txt @not_a_user!
+/lib/ @gravitational/core not-an-owner @alice
+`
+
+func TestOwners(t *testing.T) {
+	f, err := Parse(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		// The last matching pattern takes precedence.
+		{path: "README.md", want: []string{"@global-owner"}},
+		{path: "web/app.js", want: []string{"@js-owner"}},
+		{path: "main.go", want: []string{"docs@example.com"}},
+		// Leading slashes anchor patterns to the root.
+		{path: "build/logs/out.log", want: []string{"@octocat"}},
+		{path: "build/logs/2021/out.txt", want: []string{"@octocat"}},
+		{path: "src/build/logs/out.js", want: []string{"@octocat"}},
+		{path: "src/build/out.js", want: []string{"@js-owner"}},
+		// "docs/*" contains a slash, so like "/docs/" it is anchored. It
+		// matches the direct children of docs only, but "/docs/" further
+		// down matches everything below docs.
+		{path: "docs/getting-started.md", want: []string{"@doctocat"}},
+		{path: "docs/build-app/troubleshooting.md", want: []string{"@doctocat"}},
+		{path: "src/docs/index.md", want: []string{"@global-owner"}},
+		// "apps/" matches an apps directory at any depth.
+		{path: "src/apps/main.rb", want: []string{"@octocat"}},
+		// A pattern without owners leaves paths unowned.
+		{path: "apps/github/main.rb"},
+		{path: "apps/web/main.rb", want: []string{"@octocat"}},
+		// "**/logs" matches a logs directory at any depth.
+		{path: "logs/out.md", want: []string{"@octocat"}},
+		{path: "deeply/nested/logs/out.md", want: []string{"@octocat"}},
+		{path: "scripts/deploy.sh", want: []string{"@doctocat", "@octocat"}},
+		{path: "#notes", want: []string{"@escaped"}},
+		// Skipped lines do not apply.
+		{path: "CHANGELOG.md", want: []string{"@global-owner"}},
+		{path: "Readme", want: []string{"@global-owner"}},
+		{path: "notes.txt", want: []string{"@global-owner"}},
+		{path: "lib/auth.go", want: []string{"@gravitational/core", "@alice"}},
+		{path: "/lib/auth.go", want: []string{"@gravitational/core", "@alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := f.Owners(tt.path)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got owners %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, r := range f.Rules {
+		lines = append(lines, r.Line)
+	}
+	// Lines 17, 18 and 20 are skipped.
+	want := []int{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 21}
+	if len(lines) != len(want) {
+		t.Fatalf("got rules on lines %v, want %v", lines, want)
+	}
+	for i := range lines {
+		if lines[i] != want[i] {
+			t.Fatalf("got rules on lines %v, want %v", lines, want)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Package config loads the review bot configuration file.
+//
+// The configuration replaces the inline --reviewers JSON that used to be
+// passed on the command line. It lives in the repository (by default at
+// .github/review-bot.yaml) so that changes to review policy are themselves
+// reviewed.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is where the configuration is read from when no path is given.
+const DefaultPath = ".github/review-bot.yaml"
+
+// DefaultPoolName is the name of the pool built from the defaults section.
+const DefaultPoolName = "default"
+
+// Contributor classes. They can be used as entries in a pool's authors and
+// as keys of the contributors section.
+const (
+	// Internal contributors are organization members or collaborators with
+	// write access, pushing from the repository or their own fork.
+	Internal = "internal"
+	// External contributors are everyone else.
+	External = "external"
+	// Bot is a GitHub App or other bot account.
+	Bot = "bot"
+	// FirstTime is an external contributor opening their first pull request.
+	FirstTime = "first-time"
+)
+
+// isClass reports whether s names a contributor class.
+func isClass(s string) bool {
+	switch s {
+	case Internal, External, Bot, FirstTime:
+		return true
+	}
+	return false
+}
+
+// Config is the review bot configuration.
+type Config struct {
+	// Groups maps an author group name to its members. Members are GitHub
+	// logins or "@org/team" references.
+	Groups map[string][]string `yaml:"groups"`
+	// Defaults is the pool used for files that no other pool covers.
+	Defaults Pool `yaml:"defaults"`
+	// Pools are reviewer pools owning parts of the repository.
+	Pools []Pool `yaml:"pools"`
+	// CodeOwners additionally requires an approval from the owners of every
+	// changed file listed in the repository's CODEOWNERS file.
+	CodeOwners bool `yaml:"codeowners"`
+	// Availability controls how out-of-office reviewers are detected.
+	Availability Availability `yaml:"availability"`
+	// Contributors sets per contributor class policy, keyed by Internal,
+	// External, Bot or FirstTime.
+	Contributors map[string]ContributorPolicy `yaml:"contributors"`
+	// Workflows is the policy lint-workflows checks the repository's
+	// workflow files against.
+	Workflows WorkflowPolicy `yaml:"workflows"`
+}
+
+// WorkflowPolicy is the security baseline for workflow files.
+type WorkflowPolicy struct {
+	// DefaultBranch is the only ref pull_request_target and workflow_run
+	// workflows may check out. Defaults to "master".
+	DefaultBranch string `yaml:"default_branch"`
+	// Permissions maps GITHUB_TOKEN scopes to the highest level, "read",
+	// "write" or "none", workflows may grant. Scopes listed as "none" or
+	// not listed at all may not be granted.
+	Permissions map[string]string `yaml:"permissions"`
+}
+
+// ContributorPolicy is the review policy for a class of contributors.
+type ContributorPolicy struct {
+	// Approvals raises the number of approvals every pool requires from
+	// pull requests by this class of contributor.
+	Approvals int `yaml:"approvals"`
+}
+
+// Availability configures the sources used to skip unavailable reviewers.
+type Availability struct {
+	// Calendar is the path of an out-of-office calendar. Relative paths are
+	// resolved against the directory of the configuration file.
+	Calendar string `yaml:"calendar"`
+	// GitHubStatus treats reviewers whose GitHub status indicates limited
+	// availability ("busy") as unavailable.
+	GitHubStatus bool `yaml:"github_status"`
+}
+
+// Pool is a set of reviewers responsible for a set of paths.
+type Pool struct {
+	// Name identifies the pool in logs and status output.
+	Name string `yaml:"name"`
+	// Paths are glob patterns matched against the files changed by a pull
+	// request. "*" matches within a path segment, "**" matches any number
+	// of segments. An empty list matches every file.
+	Paths []string `yaml:"paths"`
+	// Authors restricts the pool to pull requests opened by these authors.
+	// Entries are group names, contributor classes, logins or "@org/team"
+	// references. An empty list applies the pool to every author.
+	Authors []string `yaml:"authors"`
+	// Reviewers are the candidates asked to review, as logins or "@org/team"
+	// references. Any member of a team counts towards the pool's approvals.
+	Reviewers []string `yaml:"reviewers"`
+	// Approvals is the number of approvals required from this pool.
+	// Defaults to one.
+	Approvals int `yaml:"approvals"`
+	// LoadBalance requests only as many reviewers as approvals are required,
+	// picking the candidates with the fewest open review requests, instead
+	// of requesting every candidate.
+	LoadBalance bool `yaml:"load_balance"`
+	// RequestTeams requests "@org/team" reviewers as teams. Otherwise teams
+	// are expanded and as many members as approvals are required are
+	// requested individually.
+	RequestTeams bool `yaml:"request_teams"`
+}
+
+// Load reads and checks the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cal := c.Availability.Calendar; cal != "" && !filepath.IsAbs(cal) {
+		c.Availability.Calendar = filepath.Join(filepath.Dir(path), cal)
+	}
+	return c, nil
+}
+
+// Parse decodes a configuration and checks it for structural errors.
+func Parse(data []byte) (*Config, error) {
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Defaults.Name == "" {
+		c.Defaults.Name = DefaultPoolName
+	}
+	if err := c.CheckAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CheckAndSetDefaults validates the configuration without contacting GitHub.
+func (c *Config) CheckAndSetDefaults() error {
+	var problems []string
+	if len(c.Defaults.Reviewers) == 0 {
+		problems = append(problems, "defaults: no reviewers")
+	}
+	if len(c.Defaults.Paths) != 0 || len(c.Defaults.Authors) != 0 {
+		problems = append(problems, "defaults: paths and authors are not allowed")
+	}
+	names := map[string]bool{c.Defaults.Name: true}
+	for i := range c.Pools {
+		p := &c.Pools[i]
+		if p.Name == "" {
+			problems = append(problems, fmt.Sprintf("pools[%d]: missing name", i))
+		} else if names[p.Name] {
+			problems = append(problems, fmt.Sprintf("pool %q: duplicate name", p.Name))
+		}
+		names[p.Name] = true
+		if len(p.Reviewers) == 0 {
+			problems = append(problems, fmt.Sprintf("pool %q: no reviewers", p.Name))
+		}
+		for _, pattern := range p.Paths {
+			if err := checkPattern(pattern); err != nil {
+				problems = append(problems, fmt.Sprintf("pool %q: bad path %q: %v", p.Name, pattern, err))
+			}
+		}
+	}
+	for _, p := range c.all() {
+		if p.Approvals < 0 {
+			problems = append(problems, fmt.Sprintf("pool %q: negative approvals", p.Name))
+		}
+		// Teams are only expanded at runtime, so their size is unknown here.
+		if p.Approvals > len(p.Reviewers) && !p.HasTeams() {
+			problems = append(problems, fmt.Sprintf("pool %q: %d approvals required but only %d reviewers",
+				p.Name, p.Approvals, len(p.Reviewers)))
+		}
+	}
+	for class, policy := range c.Contributors {
+		if !isClass(class) {
+			problems = append(problems, fmt.Sprintf("contributors: unknown class %q", class))
+		}
+		if policy.Approvals < 0 {
+			problems = append(problems, fmt.Sprintf("contributors: %v: negative approvals", class))
+		}
+	}
+	for scope, level := range c.Workflows.Permissions {
+		switch level {
+		case "read", "write", "none":
+		default:
+			problems = append(problems, fmt.Sprintf("workflows: permissions: %v: unknown level %q", scope, level))
+		}
+	}
+	if c.Workflows.DefaultBranch == "" {
+		c.Workflows.DefaultBranch = "master"
+	}
+	if c.Defaults.Approvals == 0 {
+		c.Defaults.Approvals = 1
+	}
+	for i := range c.Pools {
+		if c.Pools[i].Approvals == 0 {
+			c.Pools[i].Approvals = 1
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// all returns the defaults pool followed by the configured pools.
+func (c *Config) all() []Pool {
+	return append([]Pool{c.Defaults}, c.Pools...)
+}
+
+// Author describes the author of a pull request for pool matching.
+type Author struct {
+	// Login is the author's GitHub login.
+	Login string
+	// Class is the author's contributor class, one of Internal, External,
+	// Bot or FirstTime.
+	Class string
+	// IsTeamMember resolves "@org/team" author references. It may be nil if
+	// none are used.
+	IsTeamMember func(org, slug, user string) bool
+}
+
+// Match returns the pools responsible for a pull request by author that
+// changes files. Files that no applicable pool covers fall back to the
+// defaults pool.
+func (c *Config) Match(author Author, files []string) []Pool {
+	var pools []Pool
+	covered := make([]bool, len(files))
+	for _, p := range c.Pools {
+		if !c.appliesTo(p, author) {
+			continue
+		}
+		matched := false
+		for i, file := range files {
+			if p.Matches(file) {
+				covered[i] = true
+				matched = true
+			}
+		}
+		if matched {
+			pools = append(pools, p)
+		}
+	}
+	needDefaults := len(files) == 0
+	for _, ok := range covered {
+		if !ok {
+			needDefaults = true
+		}
+	}
+	if needDefaults {
+		pools = append([]Pool{c.Defaults}, pools...)
+	}
+	return pools
+}
+
+// Approvals returns the number of approvals pool p requires from a
+// contributor of the given class.
+func (c *Config) Approvals(p Pool, class string) int {
+	if policy, ok := c.Contributors[class]; ok && policy.Approvals > p.Approvals {
+		return policy.Approvals
+	}
+	return p.Approvals
+}
+
+// appliesTo reports whether pool p applies to pull requests by author.
+// Author entries are resolved as group names first, then contributor
+// classes, then logins or teams.
+func (c *Config) appliesTo(p Pool, author Author) bool {
+	if len(p.Authors) == 0 {
+		return true
+	}
+	for _, entry := range p.Authors {
+		members, ok := c.Groups[entry]
+		if !ok {
+			if isClass(entry) {
+				if entry == author.Class {
+					return true
+				}
+				continue
+			}
+			members = []string{entry}
+		}
+		for _, member := range members {
+			if org, slug, ok := ParseTeam(member); ok {
+				if author.IsTeamMember != nil && author.IsTeamMember(org, slug, author.Login) {
+					return true
+				}
+				continue
+			}
+			if strings.EqualFold(member, author.Login) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Matches reports whether file is covered by the pool's paths.
+func (p Pool) Matches(file string) bool {
+	if len(p.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range p.Paths {
+		if matchPath(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTeams reports whether any of the pool's reviewers is a team.
+func (p Pool) HasTeams() bool {
+	for _, r := range p.Reviewers {
+		if _, _, ok := ParseTeam(r); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTeam splits an "@org/team" reference.
+func ParseTeam(s string) (org, slug string, ok bool) {
+	if !strings.HasPrefix(s, "@") {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, "@"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// checkPattern reports malformed path patterns.
+func checkPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchPath matches name against a slash separated glob pattern where a
+// "**" segment matches zero or more path segments.
+func matchPath(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// Validate checks that every user and team referenced by the configuration
+// exists on GitHub.
+func (c *Config) Validate(ctx context.Context, client *github.Client) error {
+	users, teams := c.references()
+	var problems []string
+	for _, login := range users {
+		_, resp, err := client.Users.Get(ctx, login)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				problems = append(problems, fmt.Sprintf("user %q does not exist", login))
+				continue
+			}
+			return err
+		}
+	}
+	for _, team := range teams {
+		org, slug, _ := ParseTeam(team)
+		_, resp, err := client.Teams.GetTeamBySlug(ctx, org, slug)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				problems = append(problems, fmt.Sprintf("team %q does not exist or is not visible", team))
+				continue
+			}
+			return err
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// references returns the sorted, de-duplicated logins and team references
+// used anywhere in the configuration.
+func (c *Config) references() (users []string, teams []string) {
+	seen := map[string]bool{}
+	add := func(entry string) {
+		key := strings.ToLower(entry)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		if _, _, ok := ParseTeam(entry); ok {
+			teams = append(teams, entry)
+			return
+		}
+		users = append(users, entry)
+	}
+	for _, members := range c.Groups {
+		for _, m := range members {
+			add(m)
+		}
+	}
+	for _, p := range c.all() {
+		for _, a := range p.Authors {
+			if _, ok := c.Groups[a]; !ok && !isClass(a) {
+				add(a)
+			}
+		}
+		for _, r := range p.Reviewers {
+			add(r)
+		}
+	}
+	sort.Strings(users)
+	sort.Strings(teams)
+	return users, teams
+}
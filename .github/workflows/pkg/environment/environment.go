@@ -0,0 +1,138 @@
+// Package environment extracts the pull request the bot is working on from
+// the GitHub Actions event that triggered the workflow.
+package environment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// Environment describes the event being handled.
+type Environment struct {
+	// EventName is the name of the triggering event, e.g. "pull_request_target".
+	EventName string
+	// Action is the event's activity type, e.g. "opened" or "submitted".
+	Action string
+	// Organization is the owner of the repository.
+	Organization string
+	// Repository is the name of the repository.
+	Repository string
+	// Number is the pull request number, zero for events without one.
+	Number int
+	// Author is the login of the pull request author.
+	Author string
+	// HeadSHA is the pull request head commit.
+	HeadSHA string
+	// BaseRef is the branch the pull request merges into.
+	BaseRef string
+	// DefaultBranch is the repository's default branch, if the event
+	// carries its repository.
+	DefaultBranch string
+	// Fork is set if the pull request head lives in a different repository
+	// than its base.
+	Fork bool
+	// Event is the decoded event payload.
+	Event interface{}
+}
+
+// New reads the event from GITHUB_EVENT_NAME and GITHUB_EVENT_PATH. The
+// repository falls back to GITHUB_REPOSITORY for events that do not carry
+// one, such as schedule.
+func New() (*Environment, error) {
+	name := os.Getenv("GITHUB_EVENT_NAME")
+	if name == "" {
+		return nil, fmt.Errorf("GITHUB_EVENT_NAME is not set")
+	}
+	var payload []byte
+	if p := os.Getenv("GITHUB_EVENT_PATH"); p != "" {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		payload = data
+	}
+	env, err := Parse(name, payload)
+	if err != nil {
+		return nil, err
+	}
+	if env.Organization == "" {
+		parts := strings.SplitN(os.Getenv("GITHUB_REPOSITORY"), "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unable to determine repository for event %q", name)
+		}
+		env.Organization, env.Repository = parts[0], parts[1]
+	}
+	return env, nil
+}
+
+// Parse decodes an event payload of the given type.
+func Parse(name string, payload []byte) (*Environment, error) {
+	env := &Environment{EventName: name}
+	if len(payload) == 0 || name == "schedule" || name == "workflow_dispatch" {
+		return env, nil
+	}
+	event, err := github.ParseWebHook(name, payload)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q event: %w", name, err)
+	}
+	env.Event = event
+
+	var (
+		pr   *github.PullRequest
+		repo *github.Repository
+	)
+	switch e := event.(type) {
+	case *github.PullRequestEvent:
+		env.Action, pr, repo = e.GetAction(), e.GetPullRequest(), e.GetRepo()
+	case *github.PullRequestTargetEvent:
+		env.Action, pr, repo = e.GetAction(), e.GetPullRequest(), e.GetRepo()
+	case *github.PullRequestReviewEvent:
+		env.Action, pr, repo = e.GetAction(), e.GetPullRequest(), e.GetRepo()
+	case *github.WorkflowRunEvent:
+		env.Action, repo = e.GetAction(), e.GetRepo()
+		env.HeadSHA = e.GetWorkflowRun().GetHeadSHA()
+	case *github.PushEvent:
+		// Push events describe their repository with a different type.
+		owner := e.GetRepo().GetOwner()
+		env.Organization = owner.GetLogin()
+		if env.Organization == "" {
+			env.Organization = owner.GetName()
+		}
+		env.Repository = e.GetRepo().GetName()
+		env.DefaultBranch = e.GetRepo().GetDefaultBranch()
+		env.HeadSHA = e.GetAfter()
+	default:
+		return nil, fmt.Errorf("unsupported event %q", name)
+	}
+	if repo != nil {
+		env.Organization = repo.GetOwner().GetLogin()
+		env.Repository = repo.GetName()
+		env.DefaultBranch = repo.GetDefaultBranch()
+	}
+	if pr != nil {
+		env.Number = pr.GetNumber()
+		env.Author = pr.GetUser().GetLogin()
+		env.HeadSHA = pr.GetHead().GetSHA()
+		env.BaseRef = pr.GetBase().GetRef()
+		head, base := pr.GetHead().GetRepo(), pr.GetBase().GetRepo()
+		env.Fork = head.GetFork() || !strings.EqualFold(head.GetFullName(), base.GetFullName())
+	}
+	return env, nil
+}
+
+// PullRequest returns the pull request from the event payload, if any.
+func (e *Environment) PullRequest() *github.PullRequest {
+	switch ev := e.Event.(type) {
+	case *github.PullRequestEvent:
+		return ev.GetPullRequest()
+	case *github.PullRequestTargetEvent:
+		return ev.GetPullRequest()
+	case *github.PullRequestReviewEvent:
+		return ev.GetPullRequest()
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package flaky finds flaky jobs in the workflow run history: jobs that
+// failed and then passed on the same commit, usually after a re-run. Such
+// re-runs get the pull request merged but hide the flakiness.
+package flaky
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// Config configures Find.
+type Config struct {
+	// GitHub is the API client.
+	GitHub *github.Client
+	// Organization and Repository name the repository.
+	Organization string
+	Repository   string
+	// Workflows are the workflow file names, e.g. "check.yml".
+	Workflows []string
+	// Days is the number of days of history to look at.
+	Days int
+	// Now is the end of the window.
+	Now time.Time
+}
+
+// CheckAndSetDefaults verifies the configuration and sets defaults.
+func (c *Config) CheckAndSetDefaults() error {
+	if c.GitHub == nil {
+		return fmt.Errorf("missing GitHub client")
+	}
+	if c.Organization == "" || c.Repository == "" {
+		return fmt.Errorf("missing repository")
+	}
+	if len(c.Workflows) == 0 {
+		return fmt.Errorf("no workflows to look at")
+	}
+	if c.Days == 0 {
+		c.Days = 14
+	}
+	if c.Days < 0 {
+		return fmt.Errorf("days must be positive, got %v", c.Days)
+	}
+	if c.Now.IsZero() {
+		c.Now = time.Now()
+	}
+	c.Now = c.Now.UTC()
+	return nil
+}
+
+// Job is a job of a workflow and how flaky it is.
+type Job struct {
+	Workflow string `json:"workflow"`
+	Name     string `json:"name"`
+	// Commits is the number of commits the job passed or failed on.
+	Commits int `json:"commits"`
+	// Flakes is the number of commits the job failed and then passed on.
+	Flakes int `json:"flakes"`
+	// Rate is Flakes over Commits.
+	Rate float64 `json:"rate"`
+	// Failures are the failed attempts on the commits the job flaked on,
+	// newest first.
+	Failures []Failure `json:"failures"`
+}
+
+// Failure is a failed attempt of a job that later passed.
+type Failure struct {
+	SHA  string    `json:"sha"`
+	Time time.Time `json:"time"`
+	// URL links to the job's log.
+	URL string `json:"url"`
+}
+
+// Report is the flakiness of the jobs over a window.
+type Report struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Jobs are the jobs that flaked at least once, the flakiest first.
+	Jobs []Job `json:"jobs"`
+}
+
+// attempt is a finished attempt of a job on a commit.
+type attempt struct {
+	time       time.Time
+	conclusion string
+	url        string
+}
+
+// Find collects the jobs of every completed run of the workflows created
+// within the window, including jobs of earlier attempts of re-run runs,
+// and reports the jobs that failed and then passed on the same commit.
+// Cancelled and skipped jobs are ignored, as cancelling superseded runs is
+// routine.
+func Find(ctx context.Context, c Config) (*Report, error) {
+	if err := c.CheckAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	from := c.Now.AddDate(0, 0, -c.Days)
+
+	// Attempts by workflow, job name and commit.
+	type key struct{ workflow, job, sha string }
+	attempts := map[key][]attempt{}
+	for _, name := range c.Workflows {
+		runs, err := c.listRuns(ctx, name, from)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs {
+			jobs, err := c.listJobs(ctx, run.GetID())
+			if err != nil {
+				return nil, err
+			}
+			for _, job := range jobs {
+				switch job.GetConclusion() {
+				case "success", "failure", "timed_out":
+				default:
+					continue
+				}
+				a := attempt{time: job.GetStartedAt().Time, conclusion: job.GetConclusion(), url: job.GetHTMLURL()}
+				if a.time.IsZero() {
+					a.time = run.GetCreatedAt().Time
+				}
+				if a.url == "" {
+					a.url = run.GetHTMLURL()
+				}
+				k := key{name, job.GetName(), run.GetHeadSHA()}
+				attempts[k] = append(attempts[k], a)
+			}
+		}
+		log.Printf("Collected the jobs of %v runs of %v.", len(runs), name)
+	}
+
+	jobs := map[[2]string]*Job{}
+	for k, as := range attempts {
+		id := [2]string{k.workflow, k.job}
+		j, ok := jobs[id]
+		if !ok {
+			j = &Job{Workflow: k.workflow, Name: k.job}
+			jobs[id] = j
+		}
+		j.Commits++
+		failures := flakes(as)
+		if len(failures) == 0 {
+			continue
+		}
+		j.Flakes++
+		for _, a := range failures {
+			j.Failures = append(j.Failures, Failure{SHA: k.sha, Time: a.time, URL: a.url})
+		}
+	}
+
+	r := &Report{From: from, To: c.Now, Jobs: []Job{}}
+	for _, j := range jobs {
+		if j.Flakes == 0 {
+			continue
+		}
+		j.Rate = float64(j.Flakes) / float64(j.Commits)
+		sort.Slice(j.Failures, func(a, b int) bool { return j.Failures[a].Time.After(j.Failures[b].Time) })
+		r.Jobs = append(r.Jobs, *j)
+	}
+	sort.Slice(r.Jobs, func(a, b int) bool {
+		x, y := r.Jobs[a], r.Jobs[b]
+		if x.Rate != y.Rate {
+			return x.Rate > y.Rate
+		}
+		if x.Flakes != y.Flakes {
+			return x.Flakes > y.Flakes
+		}
+		return x.Workflow+x.Name < y.Workflow+y.Name
+	})
+	return r, nil
+}
+
+// flakes returns the failed attempts followed by a passing attempt, or
+// nil if the job did not flake.
+func flakes(as []attempt) []attempt {
+	sort.Slice(as, func(i, j int) bool { return as[i].time.Before(as[j].time) })
+	var failed, flaked []attempt
+	for _, a := range as {
+		if a.conclusion != "success" {
+			failed = append(failed, a)
+			continue
+		}
+		flaked = append(flaked, failed...)
+		failed = nil
+	}
+	return flaked
+}
+
+// listRuns returns the completed runs of workflow created since from.
+// Runs are listed newest first, so listing stops at the first older run.
+func (c *Config) listRuns(ctx context.Context, workflow string, from time.Time) ([]*github.WorkflowRun, error) {
+	var runs []*github.WorkflowRun
+	opts := &github.ListWorkflowRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := c.GitHub.Actions.ListWorkflowRunsByFileName(ctx, c.Organization, c.Repository, workflow, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range page.WorkflowRuns {
+			created := run.GetCreatedAt().Time
+			if created.Before(from) {
+				return runs, nil
+			}
+			if created.After(c.Now) || run.GetStatus() != "completed" {
+				continue
+			}
+			runs = append(runs, run)
+		}
+		if resp.NextPage == 0 {
+			return runs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listJobs returns the jobs of every attempt of a run.
+func (c *Config) listJobs(ctx context.Context, runID int64) ([]*github.WorkflowJob, error) {
+	var jobs []*github.WorkflowJob
+	opts := &github.ListWorkflowJobsOptions{Filter: "all", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := c.GitHub.Actions.ListWorkflowJobs(ctx, c.Organization, c.Repository, runID, opts)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, page.Jobs...)
+		if resp.NextPage == 0 {
+			return jobs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,113 @@
+package flaky
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/client"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/githubtest"
+)
+
+func TestFind(t *testing.T) {
+	srv := githubtest.NewServer("gravitational", "teleport")
+	defer srv.Close()
+	now := time.Date(2021, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	// run adds a completed run of check.yml for sha created hours before
+	// now, with a job per attempt conclusion, an hour apart.
+	run := func(sha string, hours int, job string, conclusions ...string) {
+		created := now.Add(-time.Duration(hours) * time.Hour)
+		r := githubtest.Run{
+			WorkflowID: 1,
+			Path:       ".github/workflows/check.yml",
+			Name:       "Check",
+			Event:      "pull_request_target",
+			HeadSHA:    sha,
+			Status:     "completed",
+			Created:    created,
+		}
+		for i, c := range conclusions {
+			started := created.Add(time.Duration(i) * time.Hour)
+			r.Jobs = append(r.Jobs, githubtest.Job{Name: job, Conclusion: c, Started: started, Completed: started.Add(time.Minute)})
+		}
+		srv.AddRun(r)
+	}
+	// "test" failed and then passed on aaa111 after a re-run, and passed
+	// on bbb222.
+	run("aaa111", 48, "test", "failure", "success")
+	run("bbb222", 24, "test", "success")
+	// "lint" failed for real on ccc333 and was cancelled on ddd444.
+	run("ccc333", 24, "lint", "failure")
+	run("ddd444", 12, "lint", "cancelled", "success")
+	// Older than the window.
+	run("eee555", 24*30, "build", "failure", "success")
+
+	gh, err := client.New(client.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Config{
+		GitHub:       gh,
+		Organization: "gravitational",
+		Repository:   "teleport",
+		Workflows:    []string{"check.yml"},
+		Now:          now,
+	}
+	report, err := Find(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.From.Equal(now.AddDate(0, 0, -14)) {
+		t.Errorf("report from %v, want the default of 14 days", report.From)
+	}
+	if len(report.Jobs) != 1 {
+		t.Fatalf("got flaky jobs %+v, want test only", report.Jobs)
+	}
+	j := report.Jobs[0]
+	if j.Name != "test" || j.Flakes != 1 || j.Commits != 2 || j.Rate != 0.5 {
+		t.Errorf("got %+v, want test flaking on 1 of 2 commits", j)
+	}
+	if len(j.Failures) != 1 || j.Failures[0].SHA != "aaa111" {
+		t.Errorf("got failures %+v, want the failure on aaa111", j.Failures)
+	}
+
+	for _, format := range []string{"table", "csv", "json"} {
+		var out bytes.Buffer
+		if err := report.Write(&out, format); err != nil {
+			t.Fatalf("writing %v: %v", format, err)
+		}
+		if !strings.Contains(out.String(), j.Failures[0].URL) {
+			t.Errorf("%v report does not link the failure:\n%v", format, out.String())
+		}
+	}
+
+	// Handling the report twice opens a single tracking issue.
+	for i := 0; i < 2; i++ {
+		if err := report.UpdateIssues(context.Background(), gh, "gravitational", "teleport"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issues := srv.Issues()
+	if len(issues) != 1 {
+		t.Fatalf("got %v issues, want 1", len(issues))
+	}
+	if !strings.Contains(issues[0].Body, marker(j)) || len(issues[0].Labels) != 1 || issues[0].Labels[0] != Label {
+		t.Errorf("got issue %+v, want the job's marker and label", issues[0])
+	}
+}
+
+func TestWriteWithoutFailures(t *testing.T) {
+	r := &Report{Jobs: []Job{{Workflow: "check.yml", Name: "test", Flakes: 1, Commits: 1, Rate: 1}}}
+	for _, format := range []string{"table", "csv", "json"} {
+		if err := r.Write(&bytes.Buffer{}, format); err != nil {
+			t.Errorf("writing %v: %v", format, err)
+		}
+	}
+	if err := r.Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("writing xml succeeded, want an error")
+	}
+}
@@ -0,0 +1,179 @@
+package flaky
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// Label marks the tracking issues of flaky jobs.
+const Label = "flaky"
+
+// maxLinks caps the failures linked from a tracking issue.
+const maxLinks = 20
+
+// Write writes the report as a table, or as CSV or JSON if format is "csv"
+// or "json".
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "table", "":
+		return r.WriteTable(w)
+	case "csv":
+		return r.WriteCSV(w)
+	case "json":
+		return r.WriteJSON(w)
+	}
+	return fmt.Errorf("unknown format %q, want table, csv or json", format)
+}
+
+// WriteTable writes the jobs as an aligned text table.
+func (r *Report) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "Jobs that failed and then passed on the same commit from %v to %v UTC.\n\n",
+		r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW\tJOB\tFLAKES\tCOMMITS\tRATE\tLAST FAILURE\t")
+	for _, j := range r.Jobs {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%.0f%%\t%v\t\n", j.Workflow, j.Name, j.Flakes, j.Commits, j.Rate*100, orDash(j.lastFailure().URL))
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes a row per job, with its most recent failure.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"workflow", "job", "flakes", "commits", "rate", "last_failure_sha", "last_failure_time", "last_failure_url"})
+	for _, j := range r.Jobs {
+		last := j.lastFailure()
+		var at string
+		if !last.Time.IsZero() {
+			at = last.Time.UTC().Format(time.RFC3339)
+		}
+		cw.Write([]string{j.Workflow, j.Name, strconv.Itoa(j.Flakes), strconv.Itoa(j.Commits),
+			strconv.FormatFloat(j.Rate, 'f', 3, 64), last.SHA, at, last.URL})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// lastFailure returns the most recent failure of the job, or an empty one
+// if it has none.
+func (j Job) lastFailure() Failure {
+	if len(j.Failures) == 0 {
+		return Failure{}
+	}
+	return j.Failures[0]
+}
+
+// orDash returns s, or "-" if s is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// marker identifies the tracking issue of a job. It is invisible when the
+// issue is rendered.
+func marker(j Job) string {
+	return fmt.Sprintf("<!-- review-bot:flaky %v/%v -->", j.Workflow, j.Name)
+}
+
+// issueBody returns the body of the tracking issue of a job.
+func (r *Report) issueBody(j Job) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, marker(j))
+	fmt.Fprintf(&b, "The job **%v** of `%v` failed and then passed on the same commit on %v of %v commits (%.0f%%) from %v to %v UTC.\n\n",
+		j.Name, j.Workflow, j.Flakes, j.Commits, j.Rate*100, r.From.Format("2006-01-02"), r.To.Format("2006-01-02"))
+	fmt.Fprintln(&b, "Failed attempts:")
+	for i, f := range j.Failures {
+		if i == maxLinks {
+			fmt.Fprintf(&b, "- and %v more\n", len(j.Failures)-maxLinks)
+			break
+		}
+		sha := f.SHA
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		fmt.Fprintf(&b, "- %v on %v at %v\n", f.URL, sha, f.Time.UTC().Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(&b, "\nThis issue is updated by the `flaky` command of the review bot.\n")
+	return b.String()
+}
+
+// UpdateIssues opens a tracking issue, labelled Label, for each flaky job
+// without an open one and brings the others up to date.
+func (r *Report) UpdateIssues(ctx context.Context, gh *github.Client, owner, repo string) error {
+	existing, err := listIssues(ctx, gh, owner, repo)
+	if err != nil {
+		return err
+	}
+	for _, j := range r.Jobs {
+		body := r.issueBody(j)
+		issue := existing[marker(j)]
+		if issue == nil {
+			log.Printf("Opening a tracking issue for %v of %v.", j.Name, j.Workflow)
+			_, _, err := gh.Issues.Create(ctx, owner, repo, &github.IssueRequest{
+				Title:  github.String(fmt.Sprintf("Flaky job: %v (%v)", j.Name, j.Workflow)),
+				Body:   github.String(body),
+				Labels: &[]string{Label},
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if issue.GetBody() == body {
+			log.Printf("Tracking issue #%v is up to date.", issue.GetNumber())
+			continue
+		}
+		log.Printf("Updating tracking issue #%v for %v of %v.", issue.GetNumber(), j.Name, j.Workflow)
+		if _, _, err := gh.Issues.Edit(ctx, owner, repo, issue.GetNumber(), &github.IssueRequest{Body: github.String(body)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listIssues returns the open issues labelled Label by their marker.
+func listIssues(ctx context.Context, gh *github.Client, owner, repo string) (map[string]*github.Issue, error) {
+	issues := map[string]*github.Issue{}
+	opts := &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{Label},
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := gh.Issues.ListByRepo(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range page {
+			body := issue.GetBody()
+			if i := strings.Index(body, "<!-- review-bot:flaky "); i >= 0 {
+				if end := strings.Index(body[i:], "-->"); end >= 0 {
+					issues[body[i:i+end+len("-->")]] = issue
+				}
+			}
+		}
+		if resp.NextPage == 0 {
+			return issues, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
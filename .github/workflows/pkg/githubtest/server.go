@@ -0,0 +1,911 @@
+// Package githubtest is an in-memory fake of the parts of the GitHub REST
+// and GraphQL APIs the bot uses, for running the bot offline against
+// scripted scenarios:
+//
+//	srv := githubtest.NewServer("gravitational", "teleport")
+//	defer srv.Close()
+//	srv.AddPullRequest(githubtest.PullRequest{Number: 1, Author: "alice", ...})
+//	gh, err := client.New(client.Config{BaseURL: srv.URL})
+//
+// The fake serves a single repository, does not paginate and ignores
+// authentication.
+package githubtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// BotLogin is the author of comments and check runs created through the
+// fake.
+const BotLogin = "github-actions[bot]"
+
+// Server is a fake GitHub API server.
+type Server struct {
+	*httptest.Server
+
+	owner, repo string
+	routes      []route
+
+	mu sync.Mutex
+	st *state
+}
+
+// NewServer starts a fake serving the repository owner/repo.
+func NewServer(owner, repo string) *Server {
+	s := &Server{owner: owner, repo: repo, st: newState()}
+	s.routes = s.makeRoutes()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	handle  func(w http.ResponseWriter, r *http.Request, args []string)
+}
+
+func (s *Server) makeRoutes() []route {
+	repo := "/repos/" + regexp.QuoteMeta(s.owner) + "/" + regexp.QuoteMeta(s.repo)
+	org := "/orgs/" + regexp.QuoteMeta(s.owner)
+	r := func(method, pattern string, handle func(w http.ResponseWriter, r *http.Request, args []string)) route {
+		return route{method, regexp.MustCompile("(?i)^" + pattern + "$"), handle}
+	}
+	return []route{
+		r("GET", repo, s.getRepo),
+		r("GET", repo+`/pulls/(\d+)`, s.getPull),
+		r("GET", repo+`/pulls/(\d+)/files`, s.listFiles),
+		r("GET", repo+`/pulls/(\d+)/commits`, s.listCommits),
+		r("GET", repo+`/commits/([0-9a-f]+)`, s.getCommit),
+		r("GET", repo+`/pulls/(\d+)/reviews`, s.listReviews),
+		r("PUT", repo+`/pulls/(\d+)/reviews/(\d+)/dismissals`, s.dismissReview),
+		r("GET", repo+`/pulls/(\d+)/requested_reviewers`, s.listReviewers),
+		r("POST", repo+`/pulls/(\d+)/requested_reviewers`, s.requestReviewers),
+		r("GET", repo+`/contents/(.+)`, s.getContents),
+		r("GET", repo+`/collaborators/([^/]+)/permission`, s.getPermission),
+		r("GET", repo+`/actions/runs`, s.listRuns),
+		r("GET", repo+`/actions/workflows/([^/]+)/runs`, s.listRuns),
+		r("GET", repo+`/actions/runs/(\d+)/timing`, s.getRunUsage),
+		r("GET", repo+`/actions/runs/(\d+)/jobs`, s.listJobs),
+		r("POST", repo+`/actions/runs/(\d+)/cancel`, s.cancelRun),
+		r("POST", repo+`/actions/runs/(\d+)/rerun`, s.rerunRun),
+		r("GET", repo+`/commits/([^/]+)/check-runs`, s.listCheckRuns),
+		r("POST", repo+`/check-runs`, s.createCheckRun),
+		r("PATCH", repo+`/check-runs/(\d+)`, s.updateCheckRun),
+		r("GET", repo+`/issues`, s.listIssues),
+		r("POST", repo+`/issues`, s.createIssue),
+		r("PATCH", repo+`/issues/(\d+)`, s.editIssue),
+		r("GET", repo+`/issues/(\d+)/comments`, s.listComments),
+		r("POST", repo+`/issues/(\d+)/comments`, s.createComment),
+		r("PATCH", repo+`/issues/comments/(\d+)`, s.editComment),
+		r("DELETE", repo+`/issues/comments/(\d+)`, s.deleteComment),
+		r("GET", org+`/members/([^/]+)`, s.isMember),
+		r("GET", org+`/teams/([^/]+)`, s.getTeam),
+		r("GET", org+`/teams/([^/]+)/members`, s.listTeamMembers),
+		r("GET", `/users/([^/]+)`, s.getUser),
+		r("GET", `/search/users`, s.searchUsers),
+		r("GET", `/search/issues`, s.searchIssues),
+		r("POST", `/graphql`, s.graphql),
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+	for _, rt := range s.routes {
+		if rt.method != r.Method {
+			continue
+		}
+		if m := rt.pattern.FindStringSubmatch(path); m != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			rt.handle(w, r, m[1:])
+			return
+		}
+	}
+	log.Printf("githubtest: no route for %v %v.", r.Method, r.URL.Path)
+	notFound(w)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func decode(r *http.Request, v interface{}) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func (s *Server) repository() *github.Repository {
+	return &github.Repository{
+		Name:     github.String(s.repo),
+		FullName: github.String(s.owner + "/" + s.repo),
+		Owner:    &github.User{Login: github.String(s.owner)},
+	}
+}
+
+func (s *Server) account(login string) *github.User {
+	u := s.st.user(login)
+	return &github.User{Login: github.String(u.Login), Type: github.String(u.Type)}
+}
+
+func (s *Server) pullRequest(pr *PullRequest) *github.PullRequest {
+	head := &github.PullRequestBranch{
+		Ref:  github.String(pr.HeadRef),
+		SHA:  github.String(pr.HeadSHA()),
+		Repo: s.repository(),
+	}
+	if pr.Fork != "" {
+		head.Repo = &github.Repository{
+			Name:     github.String(s.repo),
+			FullName: github.String(pr.Fork + "/" + s.repo),
+			Owner:    &github.User{Login: github.String(pr.Fork)},
+			Fork:     github.Bool(true),
+		}
+	}
+	return &github.PullRequest{
+		Number:            github.Int(pr.Number),
+		State:             github.String(pr.State),
+		User:              s.account(pr.Author),
+		AuthorAssociation: github.String(pr.AuthorAssociation),
+		Head:              head,
+		Base:              &github.PullRequestBranch{Ref: github.String(pr.BaseRef), Repo: s.repository()},
+	}
+}
+
+func (s *Server) review(r Review) *github.PullRequestReview {
+	return &github.PullRequestReview{
+		ID:       github.Int64(r.ID),
+		User:     s.account(r.User),
+		State:    github.String(r.State),
+		CommitID: github.String(r.CommitID),
+	}
+}
+
+func (s *Server) commit(c Commit) *github.RepositoryCommit {
+	return &github.RepositoryCommit{
+		SHA:       github.String(c.SHA),
+		Committer: s.account(c.Committer),
+		Commit: &github.Commit{
+			SHA:       github.String(c.SHA),
+			Committer: &github.CommitAuthor{Name: github.String(c.Committer)},
+			Verification: &github.SignatureVerification{
+				Verified:  github.Bool(c.Verified),
+				Reason:    github.String(c.Reason),
+				Signature: github.String(c.Signature),
+				Payload:   github.String(c.Payload),
+			},
+		},
+	}
+}
+
+func (s *Server) pull(w http.ResponseWriter, number string) (*PullRequest, bool) {
+	pr, ok := s.st.pulls[atoi(number)]
+	if !ok {
+		notFound(w)
+	}
+	return pr, ok
+}
+
+func (s *Server) getPull(w http.ResponseWriter, r *http.Request, args []string) {
+	if pr, ok := s.pull(w, args[0]); ok {
+		writeJSON(w, http.StatusOK, s.pullRequest(pr))
+	}
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request, args []string) {
+	pr, ok := s.pull(w, args[0])
+	if !ok {
+		return
+	}
+	files := []*github.CommitFile{}
+	for _, f := range pr.Files {
+		files = append(files, &github.CommitFile{Filename: github.String(f), Status: github.String("modified")})
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+func (s *Server) listCommits(w http.ResponseWriter, r *http.Request, args []string) {
+	pr, ok := s.pull(w, args[0])
+	if !ok {
+		return
+	}
+	commits := []*github.RepositoryCommit{}
+	for _, c := range pr.Commits {
+		commits = append(commits, s.commit(c))
+	}
+	writeJSON(w, http.StatusOK, commits)
+}
+
+func (s *Server) getCommit(w http.ResponseWriter, r *http.Request, args []string) {
+	for _, pr := range s.st.pulls {
+		for _, c := range pr.Commits {
+			if c.SHA == args[0] {
+				writeJSON(w, http.StatusOK, s.commit(c))
+				return
+			}
+		}
+	}
+	notFound(w)
+}
+
+func (s *Server) listReviews(w http.ResponseWriter, r *http.Request, args []string) {
+	pr, ok := s.pull(w, args[0])
+	if !ok {
+		return
+	}
+	reviews := []*github.PullRequestReview{}
+	for _, rv := range pr.Reviews {
+		reviews = append(reviews, s.review(rv))
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+func (s *Server) dismissReview(w http.ResponseWriter, r *http.Request, args []string) {
+	pr, ok := s.pull(w, args[0])
+	if !ok {
+		return
+	}
+	var req github.PullRequestReviewDismissalRequest
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	for i, rv := range pr.Reviews {
+		if rv.ID != int64(atoi(args[1])) {
+			continue
+		}
+		if rv.State != "APPROVED" && rv.State != "CHANGES_REQUESTED" {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Can not dismiss a " + strings.ToLower(rv.State) + " pull request review"})
+			return
+		}
+		pr.Reviews[i].State = "DISMISSED"
+		pr.Reviews[i].DismissalMessage = req.GetMessage()
+		writeJSON(w, http.StatusOK, s.review(pr.Reviews[i]))
+		return
+	}
+	notFound(w)
+}
+
+func (s *Server) listReviewers(w http.ResponseWriter, r *http.Request, args []string) {
+	pr, ok := s.pull(w, args[0])
+	if !ok {
+		return
+	}
+	reviewers := &github.Reviewers{Users: []*github.User{}, Teams: []*github.Team{}}
+	for _, u := range pr.RequestedUsers {
+		reviewers.Users = append(reviewers.Users, s.account(u))
+	}
+	for _, t := range pr.RequestedTeams {
+		reviewers.Teams = append(reviewers.Teams, &github.Team{Slug: github.String(t)})
+	}
+	writeJSON(w, http.StatusOK, reviewers)
+}
+
+func (s *Server) requestReviewers(w http.ResponseWriter, r *http.Request, args []string) {
+	pr, ok := s.pull(w, args[0])
+	if !ok {
+		return
+	}
+	var req github.ReviewersRequest
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	for _, u := range req.Reviewers {
+		if strings.EqualFold(u, pr.Author) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Review cannot be requested from pull request author."})
+			return
+		}
+	}
+	for _, u := range req.Reviewers {
+		pr.RequestedUsers = append(remove(pr.RequestedUsers, u), u)
+	}
+	for _, t := range req.TeamReviewers {
+		pr.RequestedTeams = append(remove(pr.RequestedTeams, t), t)
+	}
+	writeJSON(w, http.StatusCreated, s.pullRequest(pr))
+}
+
+func (s *Server) getContents(w http.ResponseWriter, r *http.Request, args []string) {
+	content, ok := s.st.contents[args[0]]
+	if !ok {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.RepositoryContent{
+		Type:     github.String("file"),
+		Path:     github.String(args[0]),
+		Encoding: github.String("base64"),
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+	})
+}
+
+func (s *Server) getRepo(w http.ResponseWriter, r *http.Request, args []string) {
+	writeJSON(w, http.StatusOK, &github.Repository{
+		Name:          github.String(s.repo),
+		FullName:      github.String(s.owner + "/" + s.repo),
+		Owner:         s.account(s.owner),
+		DefaultBranch: github.String(s.st.defaultBranch),
+	})
+}
+
+func (s *Server) getPermission(w http.ResponseWriter, r *http.Request, args []string) {
+	permission, ok := s.st.permissions[strings.ToLower(args[0])]
+	if !ok {
+		permission = "read"
+	}
+	writeJSON(w, http.StatusOK, &github.RepositoryPermissionLevel{
+		Permission: github.String(permission),
+		User:       s.account(args[0]),
+	})
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request, args []string) {
+	q := r.URL.Query()
+	status, branch, event := q.Get("status"), q.Get("branch"), q.Get("event")
+	runs := &github.WorkflowRuns{WorkflowRuns: []*github.WorkflowRun{}}
+	// Like GitHub, list the newest runs first.
+	all := make([]*Run, len(s.st.runs))
+	for i, run := range s.st.runs {
+		all[len(all)-1-i] = run
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Created.After(all[j].Created) })
+	for _, run := range all {
+		// Workflows are identified by ID or file name.
+		if len(args) > 0 && args[0] != strconv.FormatInt(run.WorkflowID, 10) && args[0] != path.Base(run.Path) {
+			continue
+		}
+		if status != "" && run.Status != status && run.Conclusion != status {
+			continue
+		}
+		if branch != "" && run.HeadBranch != branch {
+			continue
+		}
+		if event != "" && run.Event != event {
+			continue
+		}
+		wr := &github.WorkflowRun{
+			ID:         github.Int64(run.ID),
+			WorkflowID: github.Int64(run.WorkflowID),
+			Name:       github.String(run.Name),
+			Event:      github.String(run.Event),
+			HeadBranch: github.String(run.HeadBranch),
+			HeadSHA:    github.String(run.HeadSHA),
+			RunNumber:  github.Int(run.RunNumber),
+			Status:     github.String(run.Status),
+			Conclusion: github.String(run.Conclusion),
+			CreatedAt:  &github.Timestamp{Time: run.Created},
+			HTMLURL:    github.String(fmt.Sprintf("https://github.com/%v/%v/actions/runs/%v", s.owner, s.repo, run.ID)),
+		}
+		for _, n := range run.PullRequests {
+			wr.PullRequests = append(wr.PullRequests, &github.PullRequest{Number: github.Int(n)})
+		}
+		runs.WorkflowRuns = append(runs.WorkflowRuns, wr)
+	}
+	runs.TotalCount = github.Int(len(runs.WorkflowRuns))
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// run returns the run with the ID in args[0], or nil.
+func (s *Server) run(args []string) *Run {
+	for _, run := range s.st.runs {
+		if run.ID == int64(atoi(args[0])) {
+			return run
+		}
+	}
+	return nil
+}
+
+func (s *Server) getRunUsage(w http.ResponseWriter, r *http.Request, args []string) {
+	run := s.run(args)
+	if run == nil {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.WorkflowRunUsage{
+		Billable: &github.WorkflowRunEnvironment{
+			Ubuntu: &github.WorkflowRunBill{
+				TotalMS: github.Int64(run.BillableMS),
+				Jobs:    github.Int(len(run.Jobs)),
+			},
+		},
+		RunDurationMS: github.Int64(run.DurationMS),
+	})
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request, args []string) {
+	run := s.run(args)
+	if run == nil {
+		notFound(w)
+		return
+	}
+	jobs := &github.Jobs{Jobs: []*github.WorkflowJob{}}
+	for i, job := range run.Jobs {
+		wj := &github.WorkflowJob{
+			ID:         github.Int64(run.ID*100 + int64(i)),
+			RunID:      github.Int64(run.ID),
+			HeadSHA:    github.String(run.HeadSHA),
+			Name:       github.String(job.Name),
+			Status:     github.String("completed"),
+			Conclusion: github.String(job.Conclusion),
+			HTMLURL:    github.String(fmt.Sprintf("https://github.com/%v/%v/runs/%v", s.owner, s.repo, run.ID*100+int64(i))),
+		}
+		if !job.Started.IsZero() {
+			wj.StartedAt = &github.Timestamp{Time: job.Started}
+		}
+		if !job.Completed.IsZero() {
+			wj.CompletedAt = &github.Timestamp{Time: job.Completed}
+		}
+		jobs.Jobs = append(jobs.Jobs, wj)
+	}
+	jobs.TotalCount = github.Int(len(jobs.Jobs))
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, r *http.Request, args []string) {
+	for _, run := range s.st.runs {
+		if run.ID != int64(atoi(args[0])) {
+			continue
+		}
+		if run.Status == "completed" {
+			writeJSON(w, http.StatusConflict, map[string]string{"message": "Cannot cancel a workflow run that is completed."})
+			return
+		}
+		run.Status, run.Conclusion = "completed", "cancelled"
+		writeJSON(w, http.StatusAccepted, map[string]string{})
+		return
+	}
+	notFound(w)
+}
+
+func (s *Server) rerunRun(w http.ResponseWriter, r *http.Request, args []string) {
+	for _, run := range s.st.runs {
+		if run.ID != int64(atoi(args[0])) {
+			continue
+		}
+		if run.Status != "completed" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"message": "This workflow is already running"})
+			return
+		}
+		run.Status, run.Conclusion = "queued", ""
+		run.Attempts++
+		writeJSON(w, http.StatusCreated, map[string]string{})
+		return
+	}
+	notFound(w)
+}
+
+func (s *Server) checkRun(run *CheckRun) *github.CheckRun {
+	return &github.CheckRun{
+		ID:         github.Int64(run.ID),
+		Name:       github.String(run.Name),
+		HeadSHA:    github.String(run.HeadSHA),
+		Status:     github.String(run.Status),
+		Conclusion: github.String(run.Conclusion),
+		Output: &github.CheckRunOutput{
+			Title:   github.String(run.Title),
+			Summary: github.String(run.Summary),
+		},
+	}
+}
+
+func (s *Server) listCheckRuns(w http.ResponseWriter, r *http.Request, args []string) {
+	name := r.URL.Query().Get("check_name")
+	runs := &github.ListCheckRunsResults{CheckRuns: []*github.CheckRun{}}
+	for _, run := range s.st.checkRuns {
+		if run.HeadSHA == args[0] && (name == "" || run.Name == name) {
+			runs.CheckRuns = append(runs.CheckRuns, s.checkRun(run))
+		}
+	}
+	runs.Total = github.Int(len(runs.CheckRuns))
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) createCheckRun(w http.ResponseWriter, r *http.Request, args []string) {
+	var req github.CreateCheckRunOptions
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	run := &CheckRun{ID: s.st.id(), Name: req.Name, HeadSHA: req.HeadSHA, Status: "queued"}
+	applyCheckRun(run, req.Status, req.Conclusion, req.Output)
+	s.st.checkRuns = append(s.st.checkRuns, run)
+	writeJSON(w, http.StatusCreated, s.checkRun(run))
+}
+
+func (s *Server) updateCheckRun(w http.ResponseWriter, r *http.Request, args []string) {
+	var req github.UpdateCheckRunOptions
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	for _, run := range s.st.checkRuns {
+		if run.ID == int64(atoi(args[0])) {
+			if req.Name != "" {
+				run.Name = req.Name
+			}
+			applyCheckRun(run, req.Status, req.Conclusion, req.Output)
+			writeJSON(w, http.StatusOK, s.checkRun(run))
+			return
+		}
+	}
+	notFound(w)
+}
+
+func applyCheckRun(run *CheckRun, status, conclusion *string, output *github.CheckRunOutput) {
+	if status != nil {
+		run.Status = *status
+	}
+	if conclusion != nil {
+		run.Status, run.Conclusion = "completed", *conclusion
+	}
+	if output != nil {
+		run.Title, run.Summary = output.GetTitle(), output.GetSummary()
+	}
+}
+
+func (s *Server) comment(c *Comment) *github.IssueComment {
+	return &github.IssueComment{
+		ID:        github.Int64(c.ID),
+		Body:      github.String(c.Body),
+		User:      s.account(c.User),
+		CreatedAt: &time.Time{},
+	}
+}
+
+func (s *Server) issue(i *Issue) *github.Issue {
+	issue := &github.Issue{
+		Number:  github.Int(i.Number),
+		Title:   github.String(i.Title),
+		Body:    github.String(i.Body),
+		State:   github.String(i.State),
+		User:    s.account(BotLogin),
+		HTMLURL: github.String(fmt.Sprintf("https://github.com/%v/%v/issues/%v", s.owner, s.repo, i.Number)),
+	}
+	for _, l := range i.Labels {
+		issue.Labels = append(issue.Labels, &github.Label{Name: github.String(l)})
+	}
+	return issue
+}
+
+func (s *Server) listIssues(w http.ResponseWriter, r *http.Request, args []string) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state == "" {
+		state = "open"
+	}
+	var labels []string
+	if l := q.Get("labels"); l != "" {
+		labels = strings.Split(l, ",")
+	}
+	issues := []*github.Issue{}
+	for _, i := range s.st.issues {
+		if state != "all" && i.State != state {
+			continue
+		}
+		matches := true
+		for _, l := range labels {
+			matches = matches && contains(i.Labels, l)
+		}
+		if matches {
+			issues = append(issues, s.issue(i))
+		}
+	}
+	writeJSON(w, http.StatusOK, issues)
+}
+
+func (s *Server) createIssue(w http.ResponseWriter, r *http.Request, args []string) {
+	var req github.IssueRequest
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	i := &Issue{Number: int(s.st.id()), Title: req.GetTitle(), Body: req.GetBody(), State: "open"}
+	if req.Labels != nil {
+		i.Labels = *req.Labels
+	}
+	s.st.issues = append(s.st.issues, i)
+	writeJSON(w, http.StatusCreated, s.issue(i))
+}
+
+func (s *Server) editIssue(w http.ResponseWriter, r *http.Request, args []string) {
+	var req github.IssueRequest
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	for _, i := range s.st.issues {
+		if i.Number != atoi(args[0]) {
+			continue
+		}
+		if req.Title != nil {
+			i.Title = req.GetTitle()
+		}
+		if req.Body != nil {
+			i.Body = req.GetBody()
+		}
+		if req.State != nil {
+			i.State = req.GetState()
+		}
+		if req.Labels != nil {
+			i.Labels = *req.Labels
+		}
+		writeJSON(w, http.StatusOK, s.issue(i))
+		return
+	}
+	notFound(w)
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request, args []string) {
+	comments := []*github.IssueComment{}
+	for _, c := range s.st.comments {
+		if c.Number == atoi(args[0]) {
+			comments = append(comments, s.comment(c))
+		}
+	}
+	writeJSON(w, http.StatusOK, comments)
+}
+
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request, args []string) {
+	var req github.IssueComment
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	c := &Comment{ID: s.st.id(), Number: atoi(args[0]), User: BotLogin, Body: req.GetBody()}
+	s.st.comments = append(s.st.comments, c)
+	writeJSON(w, http.StatusCreated, s.comment(c))
+}
+
+func (s *Server) editComment(w http.ResponseWriter, r *http.Request, args []string) {
+	var req github.IssueComment
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	for _, c := range s.st.comments {
+		if c.ID == int64(atoi(args[0])) {
+			c.Body = req.GetBody()
+			writeJSON(w, http.StatusOK, s.comment(c))
+			return
+		}
+	}
+	notFound(w)
+}
+
+func (s *Server) deleteComment(w http.ResponseWriter, r *http.Request, args []string) {
+	for i, c := range s.st.comments {
+		if c.ID == int64(atoi(args[0])) {
+			s.st.comments = append(s.st.comments[:i], s.st.comments[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	notFound(w)
+}
+
+func (s *Server) isMember(w http.ResponseWriter, r *http.Request, args []string) {
+	if !s.st.members[strings.ToLower(args[0])] {
+		notFound(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request, args []string) {
+	if _, ok := s.st.teams[strings.ToLower(args[0])]; !ok {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.Team{Slug: github.String(strings.ToLower(args[0]))})
+}
+
+func (s *Server) listTeamMembers(w http.ResponseWriter, r *http.Request, args []string) {
+	members, ok := s.st.teams[strings.ToLower(args[0])]
+	if !ok {
+		notFound(w)
+		return
+	}
+	users := []*github.User{}
+	for _, m := range members {
+		users = append(users, s.account(m))
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request, args []string) {
+	u, ok := s.st.users[strings.ToLower(args[0])]
+	if !ok {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.User{
+		Login: github.String(u.Login),
+		Type:  github.String(u.Type),
+		Email: github.String(u.Email),
+	})
+}
+
+// searchUsers supports the "<email> in:email" queries used to resolve
+// CODEOWNERS emails.
+func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request, args []string) {
+	email := strings.TrimSpace(strings.TrimSuffix(r.URL.Query().Get("q"), "in:email"))
+	result := &github.UsersSearchResult{Users: []*github.User{}}
+	for _, u := range s.st.users {
+		if u.Email != "" && strings.EqualFold(u.Email, email) {
+			result.Users = append(result.Users, s.account(u.Login))
+		}
+	}
+	result.Total = github.Int(len(result.Users))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// searchIssues supports the "review-requested:<login>" queries used to
+// measure review load, counting open pull requests.
+func (s *Server) searchIssues(w http.ResponseWriter, r *http.Request, args []string) {
+	var login string
+	for _, term := range strings.Fields(r.URL.Query().Get("q")) {
+		if strings.HasPrefix(term, "review-requested:") {
+			login = strings.TrimPrefix(term, "review-requested:")
+		}
+	}
+	result := &github.IssuesSearchResult{Issues: []*github.Issue{}}
+	for _, pr := range s.st.pulls {
+		if pr.State != "open" {
+			continue
+		}
+		for _, u := range pr.RequestedUsers {
+			if strings.EqualFold(u, login) {
+				result.Issues = append(result.Issues, &github.Issue{Number: github.Int(pr.Number)})
+			}
+		}
+	}
+	result.Total = github.Int(len(result.Issues))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// graphql supports the user status query used to check availability and
+// the pull request query of the graphql package. Connections are returned
+// in pages of graphqlPageSize nodes.
+func (s *Server) graphql(w http.ResponseWriter, r *http.Request, args []string) {
+	var req struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if err := decode(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	var data interface{}
+	switch {
+	case strings.Contains(req.Query, "pullRequest("):
+		number, _ := req.Variables["number"].(float64)
+		pr, ok := s.st.pulls[int(number)]
+		if !ok {
+			data = map[string]interface{}{"repository": map[string]interface{}{"pullRequest": nil}}
+			break
+		}
+		data = map[string]interface{}{"repository": map[string]interface{}{"pullRequest": s.graphqlPullRequest(pr, req.Variables)}}
+	case strings.Contains(req.Query, "status") && req.Variables["login"] != nil:
+		login, _ := req.Variables["login"].(string)
+		var status interface{}
+		if u, ok := s.st.users[strings.ToLower(login)]; ok && u.Busy {
+			status = map[string]bool{"indicatesLimitedAvailability": true}
+		}
+		data = map[string]interface{}{"user": map[string]interface{}{"status": status}}
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"errors": []map[string]string{{"message": fmt.Sprintf("githubtest: unsupported query %q", req.Query)}},
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+// graphqlPageSize is the number of nodes per page of a connection, the
+// most GitHub returns.
+const graphqlPageSize = 100
+
+func (s *Server) graphqlPullRequest(pr *PullRequest, vars map[string]interface{}) map[string]interface{} {
+	// connection returns the page of nodes after the cursor in variable
+	// cursor. Cursors are node offsets.
+	connection := func(nodes []interface{}, cursor string) map[string]interface{} {
+		start := 0
+		if after, ok := vars[cursor].(string); ok && after != "" {
+			start, _ = strconv.Atoi(after)
+		}
+		if start > len(nodes) {
+			start = len(nodes)
+		}
+		end := start + graphqlPageSize
+		page := map[string]interface{}{"hasNextPage": true, "endCursor": strconv.Itoa(end)}
+		if end >= len(nodes) {
+			end = len(nodes)
+			page = map[string]interface{}{"hasNextPage": false, "endCursor": nil}
+		}
+		return map[string]interface{}{"pageInfo": page, "nodes": nodes[start:end]}
+	}
+	out := map[string]interface{}{}
+	if vars["withFiles"] == true {
+		var nodes []interface{}
+		for _, f := range pr.Files {
+			nodes = append(nodes, map[string]interface{}{"path": f})
+		}
+		out["files"] = connection(nodes, "files")
+	}
+	if vars["withCommits"] == true {
+		var nodes []interface{}
+		for _, c := range pr.Commits {
+			var signature interface{}
+			if c.Verified || (c.Reason != "" && c.Reason != "unsigned") {
+				state := strings.ToUpper(c.Reason)
+				if c.Verified {
+					state = "VALID"
+				}
+				signature = map[string]interface{}{
+					"isValid":   c.Verified,
+					"state":     state,
+					"signature": c.Signature,
+					"payload":   c.Payload,
+					"signer":    map[string]interface{}{"login": c.Committer},
+				}
+			}
+			nodes = append(nodes, map[string]interface{}{"commit": map[string]interface{}{
+				"oid": c.SHA,
+				"committer": map[string]interface{}{
+					"name": c.Committer,
+					"user": map[string]interface{}{"login": c.Committer},
+				},
+				"signature": signature,
+			}})
+		}
+		out["commits"] = connection(nodes, "commits")
+	}
+	if vars["withReviews"] == true {
+		var nodes []interface{}
+		for _, rv := range pr.Reviews {
+			nodes = append(nodes, map[string]interface{}{
+				"databaseId":  rv.ID,
+				"state":       rv.State,
+				"submittedAt": time.Time{},
+				"author":      map[string]interface{}{"login": rv.User},
+				"commit":      map[string]interface{}{"oid": rv.CommitID},
+			})
+		}
+		out["reviews"] = connection(nodes, "reviews")
+	}
+	if vars["withRequests"] == true {
+		var nodes []interface{}
+		for _, u := range pr.RequestedUsers {
+			nodes = append(nodes, map[string]interface{}{"requestedReviewer": map[string]interface{}{"__typename": "User", "login": u}})
+		}
+		for _, t := range pr.RequestedTeams {
+			nodes = append(nodes, map[string]interface{}{"requestedReviewer": map[string]interface{}{"__typename": "Team", "slug": t}})
+		}
+		out["reviewRequests"] = connection(nodes, "requests")
+	}
+	return out
+}
@@ -0,0 +1,404 @@
+package githubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// PullRequest is a pull request in the fake repository.
+type PullRequest struct {
+	Number int
+	Author string
+	// AuthorAssociation is e.g. "MEMBER" or "FIRST_TIME_CONTRIBUTOR".
+	AuthorAssociation string
+	// Fork is the owner of the fork the pull request comes from, or empty
+	// if it comes from the repository itself.
+	Fork    string
+	HeadRef string
+	BaseRef string
+	State   string
+	Files   []string
+	Commits []Commit
+	// RequestedUsers and RequestedTeams are the pending review requests.
+	RequestedUsers []string
+	RequestedTeams []string
+	Reviews        []Review
+}
+
+// HeadSHA returns the SHA of the last commit.
+func (p *PullRequest) HeadSHA() string {
+	if len(p.Commits) == 0 {
+		return ""
+	}
+	return p.Commits[len(p.Commits)-1].SHA
+}
+
+// Commit is a commit of a pull request.
+type Commit struct {
+	SHA string
+	// Committer is the committer's login, e.g. "web-flow" for commits made
+	// through the web interface.
+	Committer string
+	// Verified and Reason are the signature verification GitHub reports.
+	Verified  bool
+	Reason    string
+	Signature string
+	Payload   string
+}
+
+// Review is a pull request review.
+type Review struct {
+	ID   int64
+	User string
+	// State is e.g. "APPROVED", "CHANGES_REQUESTED" or "DISMISSED".
+	State    string
+	CommitID string
+	// DismissalMessage is the message of the dismissal, if dismissed.
+	DismissalMessage string
+}
+
+// User is a GitHub account.
+type User struct {
+	Login string
+	Email string
+	// Type is "User" or "Bot".
+	Type string
+	// Busy reports whether the user set their status to busy.
+	Busy bool
+}
+
+// Run is a workflow run.
+type Run struct {
+	ID         int64
+	WorkflowID int64
+	// Path is the workflow file, e.g. ".github/workflows/check.yml".
+	Path       string
+	Name       string
+	Event      string
+	HeadBranch string
+	HeadSHA    string
+	RunNumber  int
+	// Status is "queued", "in_progress" or "completed".
+	Status     string
+	Conclusion string
+	// PullRequests are the numbers of the pull requests the run is for.
+	PullRequests []int
+	// Attempts counts the times the run was re-run.
+	Attempts int
+	Created  time.Time
+	// DurationMS and BillableMS are the run's timing.
+	DurationMS int64
+	BillableMS int64
+	// Jobs are the jobs of every attempt of the run.
+	Jobs []Job
+}
+
+// Job is a job of a workflow run.
+type Job struct {
+	Name string
+	// Conclusion is e.g. "success", "failure" or "skipped".
+	Conclusion string
+	Started    time.Time
+	Completed  time.Time
+}
+
+// CheckRun is a check run.
+type CheckRun struct {
+	ID         int64
+	Name       string
+	HeadSHA    string
+	Status     string
+	Conclusion string
+	Title      string
+	Summary    string
+}
+
+// Comment is an issue or pull request comment.
+type Comment struct {
+	ID     int64
+	Number int
+	User   string
+	Body   string
+}
+
+// Issue is an issue. Pull requests are kept apart.
+type Issue struct {
+	Number int
+	Title  string
+	Body   string
+	Labels []string
+	// State is "open" or "closed".
+	State string
+}
+
+// state is the fake's data. Its methods expect the server's lock held.
+type state struct {
+	nextID        int64
+	defaultBranch string
+
+	users       map[string]*User
+	members     map[string]bool
+	permissions map[string]string
+	teams       map[string][]string
+	contents    map[string]string
+	pulls       map[int]*PullRequest
+	runs        []*Run
+	checkRuns   []*CheckRun
+	comments    []*Comment
+	issues      []*Issue
+}
+
+func newState() *state {
+	return &state{
+		nextID:        1000,
+		defaultBranch: "master",
+		users:         map[string]*User{},
+		members:       map[string]bool{},
+		permissions:   map[string]string{},
+		teams:         map[string][]string{},
+		contents:      map[string]string{},
+		pulls:         map[int]*PullRequest{},
+	}
+}
+
+func (st *state) id() int64 {
+	st.nextID++
+	return st.nextID
+}
+
+func (st *state) user(login string) *User {
+	if u, ok := st.users[strings.ToLower(login)]; ok {
+		return u
+	}
+	return &User{Login: login, Type: "User"}
+}
+
+// AddUser adds an account. Accounts referenced elsewhere exist implicitly,
+// but only added accounts are found by the users and search endpoints.
+func (s *Server) AddUser(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u.Type == "" {
+		u.Type = "User"
+	}
+	s.st.users[strings.ToLower(u.Login)] = &u
+}
+
+// AddMember makes login a member of the organization.
+func (s *Server) AddMember(login string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.members[strings.ToLower(login)] = true
+}
+
+// SetPermission sets login's permission on the repository, e.g. "write".
+func (s *Server) SetPermission(login, permission string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.permissions[strings.ToLower(login)] = permission
+}
+
+// SetDefaultBranch sets the repository's default branch, "master" unless
+// set.
+func (s *Server) SetDefaultBranch(branch string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.defaultBranch = branch
+}
+
+// AddTeam adds a team of the organization.
+func (s *Server) AddTeam(slug string, members ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.teams[strings.ToLower(slug)] = members
+}
+
+// SetContent sets the content of a file on every ref.
+func (s *Server) SetContent(path, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.contents[path] = content
+}
+
+// AddPullRequest adds a pull request. Missing fields get defaults.
+func (s *Server) AddPullRequest(pr PullRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pr.HeadRef == "" {
+		pr.HeadRef = fmt.Sprintf("pr-%v", pr.Number)
+	}
+	if pr.BaseRef == "" {
+		pr.BaseRef = "master"
+	}
+	if pr.State == "" {
+		pr.State = "open"
+	}
+	if pr.AuthorAssociation == "" {
+		pr.AuthorAssociation = "CONTRIBUTOR"
+	}
+	s.st.pulls[pr.Number] = &pr
+}
+
+// PullRequest returns a copy of a pull request, or nil if there is none.
+func (s *Server) PullRequest(number int) *PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr, ok := s.st.pulls[number]
+	if !ok {
+		return nil
+	}
+	c := *pr
+	c.Commits = append([]Commit(nil), pr.Commits...)
+	c.RequestedUsers = append([]string(nil), pr.RequestedUsers...)
+	c.RequestedTeams = append([]string(nil), pr.RequestedTeams...)
+	c.Reviews = append([]Review(nil), pr.Reviews...)
+	return &c
+}
+
+// Push adds commits to a pull request.
+func (s *Server) Push(number int, commits ...Commit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := s.st.pulls[number]
+	pr.Commits = append(pr.Commits, commits...)
+}
+
+// Submit submits a review of the pull request's head commit, removing the
+// reviewer's review request like GitHub does, and returns its ID.
+func (s *Server) Submit(number int, user, state string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := s.st.pulls[number]
+	id := s.st.id()
+	pr.Reviews = append(pr.Reviews, Review{ID: id, User: user, State: state, CommitID: pr.HeadSHA()})
+	pr.RequestedUsers = remove(pr.RequestedUsers, user)
+	return id
+}
+
+// AddRun adds a workflow run and returns its ID.
+func (s *Server) AddRun(r Run) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.ID == 0 {
+		r.ID = s.st.id()
+	}
+	if r.Status == "" {
+		r.Status = "queued"
+	}
+	s.st.runs = append(s.st.runs, &r)
+	return r.ID
+}
+
+// Runs returns copies of the workflow runs.
+func (s *Server) Runs() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []Run
+	for _, r := range s.st.runs {
+		runs = append(runs, *r)
+	}
+	return runs
+}
+
+// CheckRuns returns copies of the check runs.
+func (s *Server) CheckRuns() []CheckRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []CheckRun
+	for _, r := range s.st.checkRuns {
+		runs = append(runs, *r)
+	}
+	return runs
+}
+
+// Issues returns copies of the issues.
+func (s *Server) Issues() []Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var issues []Issue
+	for _, i := range s.st.issues {
+		c := *i
+		c.Labels = append([]string(nil), i.Labels...)
+		issues = append(issues, c)
+	}
+	return issues
+}
+
+// AddComment adds a comment to a pull request or issue and returns its ID.
+func (s *Server) AddComment(number int, user, body string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &Comment{ID: s.st.id(), Number: number, User: user, Body: body}
+	s.st.comments = append(s.st.comments, c)
+	return c.ID
+}
+
+// Comments returns copies of the comments on a pull request or issue.
+func (s *Server) Comments(number int) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var comments []Comment
+	for _, c := range s.st.comments {
+		if c.Number == number {
+			comments = append(comments, *c)
+		}
+	}
+	return comments
+}
+
+// PullRequestEvent returns the payload of a pull_request event for a pull
+// request, as found at GITHUB_EVENT_PATH or in a webhook delivery.
+func (s *Server) PullRequestEvent(action string, number int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr, ok := s.st.pulls[number]
+	if !ok {
+		return nil, fmt.Errorf("no pull request #%v", number)
+	}
+	return json.Marshal(&github.PullRequestEvent{
+		Action:      github.String(action),
+		Number:      github.Int(number),
+		PullRequest: s.pullRequest(pr),
+		Repo:        s.repository(),
+	})
+}
+
+// PullRequestReviewEvent returns the payload of a pull_request_review event
+// for the last review of a pull request.
+func (s *Server) PullRequestReviewEvent(action string, number int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr, ok := s.st.pulls[number]
+	if !ok || len(pr.Reviews) == 0 {
+		return nil, fmt.Errorf("no review of pull request #%v", number)
+	}
+	return json.Marshal(&github.PullRequestReviewEvent{
+		Action:      github.String(action),
+		Review:      s.review(pr.Reviews[len(pr.Reviews)-1]),
+		PullRequest: s.pullRequest(pr),
+		Repo:        s.repository(),
+	})
+}
+
+func remove(list []string, s string) []string {
+	var out []string
+	for _, l := range list {
+		if !strings.EqualFold(l, s) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,4 +2,7 @@ module github.com/gravitational/gh-actions-poc/.github/workflows/pkg
 
 go 1.16
 
-require github.com/google/go-github/v37 v37.0.0
+require (
+	github.com/google/go-github/v37 v37.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,53 @@
+// Package graphql sends queries to the GitHub GraphQL API through a go-github
+// client, sharing its authentication, base URL and transports.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// Client sends GraphQL queries.
+type Client struct {
+	gh *github.Client
+}
+
+// New returns a client sending queries through gh.
+func New(gh *github.Client) *Client {
+	return &Client{gh: gh}
+}
+
+// Query runs query with variables and decodes its "data" into out.
+func (c *Client) Query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	req, err := c.gh.NewRequest("POST", "graphql", map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := c.gh.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) != 0 {
+		var messages []string
+		for _, e := range resp.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("graphql: %v", strings.Join(messages, "; "))
+	}
+	if len(resp.Data) == 0 {
+		return fmt.Errorf("graphql: empty response")
+	}
+	return json.Unmarshal(resp.Data, out)
+}
@@ -0,0 +1,246 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// PullRequest is what the bot needs to know about a pull request, fetched
+// in as few queries as possible and converted to the go-github types the
+// REST API returns.
+type PullRequest struct {
+	// Files are the paths of the changed files.
+	Files []string
+	// Commits are the commits, oldest first, with their signature
+	// verification.
+	Commits []*github.RepositoryCommit
+	// Reviews are the submitted reviews, oldest first.
+	Reviews []*github.PullRequestReview
+	// Requested are the pending review requests.
+	Requested *github.Reviewers
+}
+
+// pageSize is the number of nodes fetched per connection and query, the
+// most GitHub allows.
+const pageSize = 100
+
+const pullRequestQuery = `query($owner: String!, $repo: String!, $number: Int!,
+  $withFiles: Boolean!, $files: String, $withCommits: Boolean!, $commits: String,
+  $withReviews: Boolean!, $reviews: String, $withRequests: Boolean!, $requests: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      files(first: 100, after: $files) @include(if: $withFiles) {
+        pageInfo { hasNextPage endCursor }
+        nodes { path }
+      }
+      commits(first: 100, after: $commits) @include(if: $withCommits) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          commit {
+            oid
+            committer { name email user { login } }
+            signature { isValid state signature payload signer { login } }
+          }
+        }
+      }
+      reviews(first: 100, after: $reviews) @include(if: $withReviews) {
+        pageInfo { hasNextPage endCursor }
+        nodes { databaseId state submittedAt author { login } commit { oid } }
+      }
+      reviewRequests(first: 100, after: $requests) @include(if: $withRequests) {
+        pageInfo { hasNextPage endCursor }
+        nodes { requestedReviewer { __typename ... on User { login } ... on Team { slug } } }
+      }
+    }
+  }
+}`
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type pullRequestData struct {
+	Repository *struct {
+		PullRequest *struct {
+			Files *struct {
+				PageInfo pageInfo `json:"pageInfo"`
+				Nodes    []struct {
+					Path string `json:"path"`
+				} `json:"nodes"`
+			} `json:"files"`
+			Commits *struct {
+				PageInfo pageInfo `json:"pageInfo"`
+				Nodes    []struct {
+					Commit commitNode `json:"commit"`
+				} `json:"nodes"`
+			} `json:"commits"`
+			Reviews *struct {
+				PageInfo pageInfo     `json:"pageInfo"`
+				Nodes    []reviewNode `json:"nodes"`
+			} `json:"reviews"`
+			ReviewRequests *struct {
+				PageInfo pageInfo `json:"pageInfo"`
+				Nodes    []struct {
+					RequestedReviewer *struct {
+						Typename string `json:"__typename"`
+						Login    string `json:"login"`
+						Slug     string `json:"slug"`
+					} `json:"requestedReviewer"`
+				} `json:"nodes"`
+			} `json:"reviewRequests"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+type commitNode struct {
+	OID       string `json:"oid"`
+	Committer struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		User  *struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"committer"`
+	Signature *struct {
+		IsValid   bool   `json:"isValid"`
+		State     string `json:"state"`
+		Signature string `json:"signature"`
+		Payload   string `json:"payload"`
+		Signer    *struct {
+			Login string `json:"login"`
+		} `json:"signer"`
+	} `json:"signature"`
+}
+
+type reviewNode struct {
+	DatabaseID  int64     `json:"databaseId"`
+	State       string    `json:"state"`
+	SubmittedAt time.Time `json:"submittedAt"`
+	Author      *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Commit *struct {
+		OID string `json:"oid"`
+	} `json:"commit"`
+}
+
+// FetchPullRequest returns the files, commits, reviews and review requests
+// of a pull request. The first query fetches the first page of every
+// connection; further queries only fetch the connections with more pages.
+func (c *Client) FetchPullRequest(ctx context.Context, owner, repo string, number int) (*PullRequest, error) {
+	pr := &PullRequest{Requested: &github.Reviewers{}}
+	vars := map[string]interface{}{
+		"owner":        owner,
+		"repo":         repo,
+		"number":       number,
+		"withFiles":    true,
+		"withCommits":  true,
+		"withReviews":  true,
+		"withRequests": true,
+	}
+	for {
+		var data pullRequestData
+		if err := c.Query(ctx, pullRequestQuery, vars, &data); err != nil {
+			return nil, err
+		}
+		if data.Repository == nil || data.Repository.PullRequest == nil {
+			return nil, fmt.Errorf("pull request %v/%v#%v not found", owner, repo, number)
+		}
+		p := data.Repository.PullRequest
+		more := false
+		if p.Files != nil {
+			for _, f := range p.Files.Nodes {
+				pr.Files = append(pr.Files, f.Path)
+			}
+			more = next(vars, "withFiles", "files", p.Files.PageInfo) || more
+		}
+		if p.Commits != nil {
+			for _, n := range p.Commits.Nodes {
+				pr.Commits = append(pr.Commits, n.Commit.toREST())
+			}
+			more = next(vars, "withCommits", "commits", p.Commits.PageInfo) || more
+		}
+		if p.Reviews != nil {
+			for _, n := range p.Reviews.Nodes {
+				pr.Reviews = append(pr.Reviews, n.toREST())
+			}
+			more = next(vars, "withReviews", "reviews", p.Reviews.PageInfo) || more
+		}
+		if p.ReviewRequests != nil {
+			for _, n := range p.ReviewRequests.Nodes {
+				r := n.RequestedReviewer
+				switch {
+				case r == nil:
+				case r.Typename == "Team":
+					pr.Requested.Teams = append(pr.Requested.Teams, &github.Team{Slug: github.String(r.Slug)})
+				case r.Login != "":
+					pr.Requested.Users = append(pr.Requested.Users, &github.User{Login: github.String(r.Login)})
+				}
+			}
+			more = next(vars, "withRequests", "requests", p.ReviewRequests.PageInfo) || more
+		}
+		if !more {
+			return pr, nil
+		}
+	}
+}
+
+// next sets up the variables to fetch the next page of a connection, or
+// to skip it if there is none, and reports whether there is one.
+func next(vars map[string]interface{}, include, cursor string, page pageInfo) bool {
+	vars[include] = page.HasNextPage
+	vars[cursor] = page.EndCursor
+	return page.HasNextPage
+}
+
+// toREST converts a commit to the form returned by the REST API.
+func (n commitNode) toREST() *github.RepositoryCommit {
+	verification := &github.SignatureVerification{
+		Verified: github.Bool(false),
+		Reason:   github.String("unsigned"),
+	}
+	if s := n.Signature; s != nil {
+		verification = &github.SignatureVerification{
+			Verified:  github.Bool(s.IsValid && s.State == "VALID"),
+			Reason:    github.String(strings.ToLower(s.State)),
+			Signature: github.String(s.Signature),
+			Payload:   github.String(s.Payload),
+		}
+	}
+	commit := &github.RepositoryCommit{
+		SHA: github.String(n.OID),
+		Commit: &github.Commit{
+			SHA: github.String(n.OID),
+			Committer: &github.CommitAuthor{
+				Name:  github.String(n.Committer.Name),
+				Email: github.String(n.Committer.Email),
+			},
+			Verification: verification,
+		},
+	}
+	if n.Committer.User != nil {
+		commit.Committer = &github.User{Login: github.String(n.Committer.User.Login)}
+	}
+	return commit
+}
+
+// toREST converts a review to the form returned by the REST API.
+func (n reviewNode) toREST() *github.PullRequestReview {
+	review := &github.PullRequestReview{
+		ID:          github.Int64(n.DatabaseID),
+		State:       github.String(n.State),
+		SubmittedAt: &n.SubmittedAt,
+	}
+	if n.Author != nil {
+		review.User = &github.User{Login: github.String(n.Author.Login)}
+	}
+	if n.Commit != nil {
+		review.CommitID = github.String(n.Commit.OID)
+	}
+	return review
+}
@@ -0,0 +1,373 @@
+// Package queue persists webhook deliveries on disk and processes them with
+// retries, so that deliveries survive GitHub outages and bot restarts.
+//
+// Each delivery is stored as a JSON file named after its delivery GUID in
+// one of three directories below the queue directory:
+//
+//	pending/  waiting to be processed, or to be retried
+//	done/     processed successfully, kept to drop redelivered duplicates
+//	failed/   gave up after the maximum number of attempts
+//
+// Handlers may run more than once for the same delivery, e.g. if the bot
+// crashes mid-handler, and must be idempotent.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pendingDir = "pending"
+	doneDir    = "done"
+	failedDir  = "failed"
+	// tmpPrefix starts the names of deliveries being written.
+	tmpPrefix = ".tmp-"
+)
+
+// Delivery is a webhook delivery.
+type Delivery struct {
+	// ID is the delivery GUID from the X-GitHub-Delivery header.
+	ID string `json:"id"`
+	// Event is the event type from the X-GitHub-Event header.
+	Event string `json:"event"`
+	// Payload is the event payload.
+	Payload json.RawMessage `json:"payload"`
+	// Received is when the delivery was enqueued.
+	Received time.Time `json:"received"`
+	// Attempts is the number of times the delivery was handled.
+	Attempts int `json:"attempts"`
+	// NextAttempt is when the delivery should next be handled.
+	NextAttempt time.Time `json:"next_attempt"`
+	// LastError is the error of the last failed attempt.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// HandlerFunc processes a delivery.
+type HandlerFunc func(ctx context.Context, d *Delivery) error
+
+// Config configures the queue.
+type Config struct {
+	// Dir is the directory the queue is stored in.
+	Dir string
+	// Handler processes deliveries.
+	Handler HandlerFunc
+	// Workers is the number of deliveries handled concurrently.
+	Workers int
+	// MaxAttempts is the number of attempts before a delivery fails.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// further attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// Retention is how long processed deliveries are remembered to drop
+	// duplicates.
+	Retention time.Duration
+}
+
+// CheckAndSetDefaults verifies the configuration.
+func (c *Config) CheckAndSetDefaults() error {
+	if c.Dir == "" {
+		return fmt.Errorf("missing queue directory")
+	}
+	if c.Handler == nil {
+		return fmt.Errorf("missing handler")
+	}
+	if c.Workers == 0 {
+		c.Workers = 4
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 10
+	}
+	if c.BaseDelay == 0 {
+		c.BaseDelay = 5 * time.Second
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = 30 * time.Minute
+	}
+	if c.Retention == 0 {
+		c.Retention = 7 * 24 * time.Hour
+	}
+	return nil
+}
+
+// Queue is a durable delivery queue.
+type Queue struct {
+	c Config
+
+	mu sync.Mutex
+	// pending holds the deliveries waiting in pending/, by ID.
+	pending map[string]*Delivery
+	// running holds the IDs of deliveries being handled.
+	running map[string]bool
+	// wake nudges the dispatcher when a delivery is enqueued.
+	wake chan struct{}
+}
+
+// New opens the queue in c.Dir, creating it if needed.
+func New(c Config) (*Queue, error) {
+	if err := c.CheckAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{pendingDir, doneDir, failedDir} {
+		if err := os.MkdirAll(filepath.Join(c.Dir, dir), 0700); err != nil {
+			return nil, err
+		}
+	}
+	q := &Queue{
+		c:       c,
+		pending: map[string]*Delivery{},
+		running: map[string]bool{},
+		wake:    make(chan struct{}, 1),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// deliveryID matches the GUIDs GitHub uses as delivery IDs. IDs become file
+// names, so nothing else is accepted.
+var deliveryID = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// Enqueue persists a delivery. It returns false if the delivery was seen
+// before and dropped as a duplicate.
+func (q *Queue) Enqueue(id, event string, payload []byte) (bool, error) {
+	if !deliveryID.MatchString(id) {
+		return false, fmt.Errorf("invalid delivery ID %q", id)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[id]; ok || q.exists(doneDir, id) || q.exists(failedDir, id) {
+		return false, nil
+	}
+	now := time.Now()
+	d := &Delivery{
+		ID:          id,
+		Event:       event,
+		Payload:     payload,
+		Received:    now,
+		NextAttempt: now,
+	}
+	if err := q.write(pendingDir, d); err != nil {
+		return false, err
+	}
+	q.pending[id] = d
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// Run handles deliveries until ctx is cancelled, then waits for the
+// deliveries being handled to finish. Deliveries left pending are picked up
+// the next time the queue runs.
+func (q *Queue) Run(ctx context.Context) {
+	work := make(chan *Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < q.c.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range work {
+				q.process(d)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		for _, d := range q.due() {
+			select {
+			case work <- d:
+			case <-ctx.Done():
+				q.release(d.ID)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			close(work)
+			wg.Wait()
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// due returns the pending deliveries whose next attempt is due and marks
+// them as running.
+func (q *Queue) due() []*Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var due []*Delivery
+	for id, d := range q.pending {
+		if q.running[id] || d.NextAttempt.After(now) {
+			continue
+		}
+		q.running[id] = true
+		copy := *d
+		due = append(due, &copy)
+	}
+	return due
+}
+
+// release marks a delivery as no longer running.
+func (q *Queue) release(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, id)
+}
+
+// process handles a delivery and records the outcome. Handlers run with
+// their own context so that shutting down lets them finish.
+func (q *Queue) process(d *Delivery) {
+	defer q.release(d.ID)
+	d.Attempts++
+	err := q.c.Handler(context.Background(), d)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err == nil {
+		log.Printf("Delivery %v handled after %v attempt(s).", d.ID, d.Attempts)
+		q.finish(d, doneDir)
+		return
+	}
+	d.LastError = err.Error()
+	if d.Attempts >= q.c.MaxAttempts {
+		log.Printf("Delivery %v failed after %v attempts: %v.", d.ID, d.Attempts, err)
+		q.finish(d, failedDir)
+		return
+	}
+	d.NextAttempt = time.Now().Add(q.backoff(d.Attempts))
+	log.Printf("Delivery %v failed, retrying at %v: %v.", d.ID, d.NextAttempt.Format(time.RFC3339), err)
+	if err := q.write(pendingDir, d); err != nil {
+		log.Printf("Failed to record attempt of delivery %v: %v.", d.ID, err)
+	}
+	q.pending[d.ID] = d
+}
+
+// finish moves a delivery out of pending/ into dir.
+func (q *Queue) finish(d *Delivery, dir string) {
+	if err := q.write(dir, d); err != nil {
+		log.Printf("Failed to record delivery %v as %v: %v.", d.ID, dir, err)
+		return
+	}
+	if err := os.Remove(q.path(pendingDir, d.ID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove pending delivery %v: %v.", d.ID, err)
+	}
+	delete(q.pending, d.ID)
+}
+
+// backoff returns the delay after the given number of failed attempts:
+// exponential from BaseDelay, capped at MaxDelay, with up to 20% jitter so
+// that deliveries failing together do not retry together.
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.c.BaseDelay
+	for i := 1; i < attempts && delay < q.c.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.c.MaxDelay {
+		delay = q.c.MaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// load reads pending deliveries left by a previous run and prunes
+// processed deliveries past their retention. Temporary files left by a
+// crash in the middle of a write are removed: the delivery they held was
+// either never acknowledged or is still stored under its own name.
+func (q *Queue) load() error {
+	files, err := ioutil.ReadDir(filepath.Join(q.c.Dir, pendingDir))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(q.c.Dir, pendingDir, f.Name())
+		if strings.HasPrefix(f.Name(), tmpPrefix) {
+			log.Printf("Removing %v left by an interrupted write.", f.Name())
+			os.Remove(path)
+			continue
+		}
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var d Delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			log.Printf("Skipping corrupt delivery %v: %v.", f.Name(), err)
+			continue
+		}
+		if !deliveryID.MatchString(d.ID) || f.Name() != d.ID+".json" {
+			log.Printf("Skipping delivery %v with ID %q.", f.Name(), d.ID)
+			continue
+		}
+		q.pending[d.ID] = &d
+	}
+	if len(q.pending) != 0 {
+		log.Printf("Resuming %v pending deliveries.", len(q.pending))
+	}
+
+	done, err := ioutil.ReadDir(filepath.Join(q.c.Dir, doneDir))
+	if err != nil {
+		return err
+	}
+	for _, f := range done {
+		if time.Since(f.ModTime()) > q.c.Retention {
+			os.Remove(filepath.Join(q.c.Dir, doneDir, f.Name()))
+		}
+	}
+	return nil
+}
+
+func (q *Queue) path(dir, id string) string {
+	return filepath.Join(q.c.Dir, dir, id+".json")
+}
+
+func (q *Queue) exists(dir, id string) bool {
+	_, err := os.Stat(q.path(dir, id))
+	return err == nil
+}
+
+// write stores d in dir atomically, so that a crash never leaves a
+// truncated delivery behind.
+func (q *Queue) write(dir string, d *Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(q.c.Dir, dir), tmpPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path(dir, d.ID))
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runUntil runs q until it has handled n deliveries, reported on handled.
+func runUntil(t *testing.T, q *Queue, handled <-chan string, n int) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	var ids []string
+	for len(ids) < n {
+		select {
+		case id := <-handled:
+			ids = append(ids, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("handled %v, want %v deliveries", ids, n)
+		}
+	}
+	return ids
+}
+
+func TestLoadAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	pending := filepath.Join(dir, pendingDir)
+	if err := os.MkdirAll(pending, 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		// A crash in the middle of writing a delivery.
+		tmpPrefix + "123456": `{"id":"bbb","event":"pu`,
+		// Deliveries without an ID, or stored under another name, cannot
+		// be tracked.
+		"ccc.json": `{"event":"push","payload":{}}`,
+		"ddd.json": `{"id":"eee","event":"push","payload":{}}`,
+		"fff.json": `{"id":"fff","event":"push","payload":{}}`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(pending, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handled := make(chan string, 10)
+	q, err := New(Config{Dir: dir, Handler: func(ctx context.Context, d *Delivery) error {
+		handled <- d.ID
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.pending) != 1 || q.pending["fff"] == nil {
+		t.Fatalf("loaded %v, want fff only", q.pending)
+	}
+	if _, err := os.Stat(filepath.Join(pending, tmpPrefix+"123456")); !os.IsNotExist(err) {
+		t.Errorf("partial write left in place: %v", err)
+	}
+	if ids := runUntil(t, q, handled, 1); ids[0] != "fff" {
+		t.Errorf("handled %v, want fff", ids)
+	}
+	select {
+	case id := <-handled:
+		t.Errorf("handled %v, want fff only", id)
+	default:
+	}
+}
+
+func TestRestart(t *testing.T) {
+	dir := t.TempDir()
+	handled := make(chan string, 10)
+	handler := func(ctx context.Context, d *Delivery) error {
+		handled <- d.ID
+		return nil
+	}
+
+	// The bot stops before handling the delivery.
+	q, err := New(Config{Dir: dir, Handler: handler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued, err := q.Enqueue("aaa", "push", []byte(`{}`)); err != nil || !queued {
+		t.Fatalf("queued %v (%v), want true", queued, err)
+	}
+
+	// The next run replays it, once.
+	q, err = New(Config{Dir: dir, Handler: handler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued, err := q.Enqueue("aaa", "push", []byte(`{}`)); err != nil || queued {
+		t.Errorf("queued a redelivery of a pending delivery: %v (%v)", queued, err)
+	}
+	if ids := runUntil(t, q, handled, 1); ids[0] != "aaa" {
+		t.Errorf("handled %v, want aaa", ids)
+	}
+
+	// Handled deliveries are remembered across restarts.
+	q, err = New(Config{Dir: dir, Handler: handler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.pending) != 0 {
+		t.Errorf("loaded %v after handling, want none", q.pending)
+	}
+	if queued, err := q.Enqueue("aaa", "push", []byte(`{}`)); err != nil || queued {
+		t.Errorf("queued a redelivery of a handled delivery: %v (%v)", queued, err)
+	}
+}
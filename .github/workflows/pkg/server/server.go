@@ -0,0 +1,139 @@
+// Package server receives GitHub webhook deliveries and hands them to the
+// bot, as an alternative to running a workflow for every event.
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/environment"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/queue"
+)
+
+// shutdownTimeout bounds how long Run waits for in-flight deliveries when
+// stopping.
+const shutdownTimeout = 30 * time.Second
+
+// Config configures the server.
+type Config struct {
+	// Addr is the address to listen on, e.g. ":8080".
+	Addr string
+	// Secret is the webhook secret shared with GitHub.
+	Secret []byte
+	// Queue persists and handles deliveries.
+	Queue *queue.Queue
+}
+
+// CheckAndSetDefaults verifies the configuration.
+func (c *Config) CheckAndSetDefaults() error {
+	if c.Addr == "" {
+		c.Addr = ":8080"
+	}
+	if len(c.Secret) == 0 {
+		return fmt.Errorf("missing webhook secret")
+	}
+	if c.Queue == nil {
+		return fmt.Errorf("missing queue")
+	}
+	return nil
+}
+
+// Server is the webhook receiver.
+type Server struct {
+	c Config
+}
+
+// New returns a server.
+func New(c Config) (*Server, error) {
+	if err := c.CheckAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	return &Server{c: c}, nil
+}
+
+// Handler returns the HTTP handler serving "/webhook" and "/healthz".
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", s.handleWebhook)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	return mux
+}
+
+// Run serves and handles queued deliveries until ctx is cancelled, then
+// stops accepting deliveries and waits for those being handled to finish.
+// Deliveries not handled yet stay queued for the next run.
+func (s *Server) Run(ctx context.Context) error {
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	queueDone := make(chan struct{})
+	go func() {
+		s.c.Queue.Run(queueCtx)
+		close(queueDone)
+	}()
+
+	srv := &http.Server{Addr: s.c.Addr, Handler: s.Handler()}
+	errC := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %v.", s.c.Addr)
+		errC <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-errC:
+	case <-ctx.Done():
+		log.Printf("Shutting down.")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = srv.Shutdown(shutdownCtx)
+	}
+	stopQueue()
+	<-queueDone
+	return err
+}
+
+// handleWebhook validates a delivery and queues it. GitHub expects a
+// response within seconds, so deliveries are acknowledged once persisted
+// and handled in the background.
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := github.ValidatePayload(r, s.c.Secret)
+	if err != nil {
+		log.Printf("Rejecting delivery: %v.", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	eventType, delivery := github.WebHookType(r), github.DeliveryID(r)
+	if eventType == "ping" {
+		io.WriteString(w, "pong\n")
+		return
+	}
+	if _, err := environment.Parse(eventType, payload); err != nil {
+		log.Printf("Ignoring delivery %v: %v.", delivery, err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	queued, err := s.c.Queue.Enqueue(delivery, eventType, payload)
+	if err != nil {
+		log.Printf("Failed to queue delivery %v: %v.", delivery, err)
+		http.Error(w, "failed to queue delivery", http.StatusInternalServerError)
+		return
+	}
+	if !queued {
+		log.Printf("Dropping duplicate delivery %v.", delivery)
+		io.WriteString(w, "duplicate\n")
+		return
+	}
+	log.Printf("Queued delivery %v: %v.", delivery, eventType)
+	w.WriteHeader(http.StatusAccepted)
+}
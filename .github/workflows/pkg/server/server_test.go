@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/queue"
+)
+
+const testSecret = "s3cr3t"
+
+// testPayload is a minimal pull_request_target event.
+const testPayload = `{"action":"opened","number":1,"pull_request":{"number":1,"head":{"sha":"aaa111"}},"repository":{"name":"teleport","owner":{"login":"gravitational"}}}`
+
+// sign returns the X-Hub-Signature-256 header of payload.
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		desc      string
+		method    string
+		event     string
+		delivery  string
+		signature string
+		status    int
+		queued    bool
+	}{
+		{
+			desc:      "valid signature",
+			event:     "pull_request_target",
+			delivery:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			signature: sign(testSecret, testPayload),
+			status:    http.StatusAccepted,
+			queued:    true,
+		},
+		{
+			desc:     "missing signature",
+			event:    "pull_request_target",
+			delivery: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			status:   http.StatusUnauthorized,
+		},
+		{
+			desc:      "wrong signature",
+			event:     "pull_request_target",
+			delivery:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			signature: sign("wrong", testPayload),
+			status:    http.StatusUnauthorized,
+		},
+		{
+			desc:      "unknown event",
+			event:     "issues",
+			delivery:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			signature: sign(testSecret, testPayload),
+			status:    http.StatusAccepted,
+		},
+		{
+			desc:      "ping",
+			event:     "ping",
+			delivery:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			signature: sign(testSecret, testPayload),
+			status:    http.StatusOK,
+		},
+		{
+			desc:      "delivery that cannot be queued",
+			event:     "pull_request_target",
+			delivery:  "../72d3162e",
+			signature: sign(testSecret, testPayload),
+			status:    http.StatusInternalServerError,
+		},
+		{
+			desc:   "not a POST",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			q, err := queue.New(queue.Config{
+				Dir:     dir,
+				Handler: func(ctx context.Context, d *queue.Delivery) error { return nil },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := New(Config{Secret: []byte(testSecret), Queue: q})
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(s.Handler())
+			defer srv.Close()
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, err := http.NewRequest(method, srv.URL+"/webhook", strings.NewReader(testPayload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-GitHub-Delivery", tt.delivery)
+			if tt.signature != "" {
+				req.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("got status %v, want %v", resp.StatusCode, tt.status)
+			}
+			// The delivery is acknowledged only once it is on disk. The
+			// queue is not running, so it is still pending.
+			_, err = os.Stat(filepath.Join(dir, "pending", tt.delivery+".json"))
+			if queued := err == nil; queued != tt.queued {
+				t.Errorf("queued %v, want %v", queued, tt.queued)
+			}
+		})
+	}
+}
+
+func TestDuplicateDelivery(t *testing.T) {
+	q, err := queue.New(queue.Config{
+		Dir:     t.TempDir(),
+		Handler: func(ctx context.Context, d *queue.Delivery) error { return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{Secret: []byte(testSecret), Queue: q})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []int
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(testPayload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "pull_request_target")
+		req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+		req.Header.Set("X-Hub-Signature-256", sign(testSecret, testPayload))
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, req)
+		statuses = append(statuses, w.Code)
+	}
+	if statuses[0] != http.StatusAccepted || statuses[1] != http.StatusOK {
+		t.Errorf("got statuses %v, want 202 then 200 for the duplicate", statuses)
+	}
+}
@@ -0,0 +1,109 @@
+package usage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Formats the report can be written in.
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// Write writes the report in format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatTable, "":
+		return r.WriteTable(w)
+	case FormatCSV:
+		return r.WriteCSV(w)
+	case FormatJSON:
+		return r.WriteJSON(w)
+	}
+	return fmt.Errorf("unknown format %q, want %v, %v or %v", format, FormatTable, FormatCSV, FormatJSON)
+}
+
+// WriteTable writes the totals, with their trend, and the daily usage as
+// aligned text tables.
+func (r *Report) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "Usage from %v to %v UTC, compared with the period before.\n\n",
+		r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW\tEVENT\tRUNS\tJOBS\tJOB MIN\tBILLABLE MIN\tDURATION MIN\tPREVIOUS JOB MIN\tCHANGE\t")
+	var total Trend
+	for _, t := range r.Totals {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%.1f\t%.1f\t%v\t%v\t\n", t.Workflow, t.Event, t.Runs, t.Jobs,
+			t.JobMinutes, t.BillableMinutes, t.DurationMinutes, t.PreviousJobMinutes, formatChange(t))
+		total.add(t.Usage)
+		total.PreviousJobMinutes += t.PreviousJobMinutes
+	}
+	if total.PreviousJobMinutes > 0 {
+		change := float64(total.JobMinutes-total.PreviousJobMinutes) / float64(total.PreviousJobMinutes)
+		total.Change = &change
+	}
+	fmt.Fprintf(tw, "total\t\t%v\t%v\t%v\t%.1f\t%.1f\t%v\t%v\t\n", total.Runs, total.Jobs,
+		total.JobMinutes, total.BillableMinutes, total.DurationMinutes, total.PreviousJobMinutes, formatChange(total))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW\tEVENT\tDAY\tRUNS\tJOBS\tJOB MIN\tBILLABLE MIN\tDURATION MIN\t")
+	for _, d := range r.Daily {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%.1f\t%.1f\t\n", d.Workflow, d.Event, d.Day, d.Runs, d.Jobs,
+			d.JobMinutes, d.BillableMinutes, d.DurationMinutes)
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes the totals, with "total" as their day, followed by the
+// daily usage. The trend columns are empty for daily rows.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"workflow", "event", "day", "runs", "jobs", "job_minutes", "billable_minutes",
+		"duration_minutes", "previous_runs", "previous_job_minutes", "change"})
+	row := func(u Usage, day string) []string {
+		return []string{u.Workflow, u.Event, day, strconv.Itoa(u.Runs), strconv.Itoa(u.Jobs),
+			strconv.FormatInt(u.JobMinutes, 10), strconv.FormatFloat(u.BillableMinutes, 'f', 1, 64),
+			strconv.FormatFloat(u.DurationMinutes, 'f', 1, 64)}
+	}
+	for _, t := range r.Totals {
+		change := ""
+		if t.Change != nil {
+			change = strconv.FormatFloat(*t.Change, 'f', 3, 64)
+		}
+		cw.Write(append(row(t.Usage, "total"), strconv.Itoa(t.PreviousRuns),
+			strconv.FormatInt(t.PreviousJobMinutes, 10), change))
+	}
+	for _, d := range r.Daily {
+		cw.Write(append(row(d, d.Day), "", "", ""))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// formatChange formats the change in job minutes as a signed percentage.
+func formatChange(t Trend) string {
+	switch {
+	case t.Change != nil:
+		return fmt.Sprintf("%+.0f%%", *t.Change*100)
+	case t.JobMinutes > 0:
+		return "new"
+	}
+	return "-"
+}
@@ -0,0 +1,255 @@
+// Package usage reports the GitHub Actions minutes the repository's
+// workflows use, by workflow, triggering event and day, compared with the
+// period before.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// Config configures Collect.
+type Config struct {
+	// GitHub is the API client.
+	GitHub *github.Client
+	// Organization and Repository name the repository.
+	Organization string
+	Repository   string
+	// Workflows are the workflow file names, e.g. "check.yml".
+	Workflows []string
+	// Days is the length of the reported period. It is compared with the
+	// period of the same length before it.
+	Days int
+	// Now is the end of the reported period.
+	Now time.Time
+}
+
+// CheckAndSetDefaults verifies the configuration and sets defaults.
+func (c *Config) CheckAndSetDefaults() error {
+	if c.GitHub == nil {
+		return fmt.Errorf("missing GitHub client")
+	}
+	if c.Organization == "" || c.Repository == "" {
+		return fmt.Errorf("missing repository")
+	}
+	if len(c.Workflows) == 0 {
+		return fmt.Errorf("no workflows to report on")
+	}
+	if c.Days == 0 {
+		c.Days = 7
+	}
+	if c.Days < 0 {
+		return fmt.Errorf("days must be positive, got %v", c.Days)
+	}
+	if c.Now.IsZero() {
+		c.Now = time.Now()
+	}
+	c.Now = c.Now.UTC()
+	return nil
+}
+
+// Usage is the usage of a workflow for an event, on a day or over the
+// whole period.
+type Usage struct {
+	Workflow string `json:"workflow"`
+	Event    string `json:"event"`
+	// Day is the UTC day the runs were created, empty for the period.
+	Day  string `json:"day,omitempty"`
+	Runs int    `json:"runs"`
+	Jobs int    `json:"jobs"`
+	// JobMinutes sums the durations of the jobs, each rounded up to a
+	// whole minute as GitHub bills them.
+	JobMinutes int64 `json:"job_minutes"`
+	// BillableMinutes is the time GitHub reports as billable. It is zero
+	// for public repositories, which are not billed.
+	BillableMinutes float64 `json:"billable_minutes"`
+	// DurationMinutes sums the wall clock time of the runs.
+	DurationMinutes float64 `json:"duration_minutes"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.Runs += o.Runs
+	u.Jobs += o.Jobs
+	u.JobMinutes += o.JobMinutes
+	u.BillableMinutes += o.BillableMinutes
+	u.DurationMinutes += o.DurationMinutes
+}
+
+// Trend is the usage of a workflow for an event over the period, compared
+// with the period before.
+type Trend struct {
+	Usage
+	PreviousRuns       int   `json:"previous_runs"`
+	PreviousJobMinutes int64 `json:"previous_job_minutes"`
+	// Change is the relative change in job minutes, e.g. 0.5 for half as
+	// many again. It is nil if the previous period used none.
+	Change *float64 `json:"change,omitempty"`
+}
+
+// Report is the usage over a period.
+type Report struct {
+	// From and To delimit the period.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Totals are the usage per workflow and event over the period.
+	Totals []Trend `json:"totals"`
+	// Daily are the usage per workflow, event and day.
+	Daily []Usage `json:"daily"`
+}
+
+// Collect pages through the runs of each workflow created during the
+// period and the period before, and sums their job timings and billable
+// time. Runs that have not completed are skipped.
+func Collect(ctx context.Context, c Config) (*Report, error) {
+	if err := c.CheckAndSetDefaults(); err != nil {
+		return nil, err
+	}
+	period := time.Duration(c.Days) * 24 * time.Hour
+	from := c.Now.Add(-period)
+	previousFrom := from.Add(-period)
+
+	daily := map[string]*Usage{}
+	totals := map[string]*Trend{}
+	for _, name := range c.Workflows {
+		var runs int
+		err := c.eachRun(ctx, name, previousFrom, func(run *github.WorkflowRun) error {
+			u, err := c.runUsage(ctx, name, run)
+			if err != nil {
+				return err
+			}
+			runs++
+			key := name + "\x00" + u.Event
+			t, ok := totals[key]
+			if !ok {
+				t = &Trend{Usage: Usage{Workflow: name, Event: u.Event}}
+				totals[key] = t
+			}
+			if run.GetCreatedAt().Before(from) {
+				t.PreviousRuns += u.Runs
+				t.PreviousJobMinutes += u.JobMinutes
+				return nil
+			}
+			t.add(u)
+			dayKey := key + "\x00" + u.Day
+			d, ok := daily[dayKey]
+			if !ok {
+				d = &Usage{Workflow: name, Event: u.Event, Day: u.Day}
+				daily[dayKey] = d
+			}
+			d.add(u)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Collected the usage of %v runs of %v.", runs, name)
+	}
+
+	r := &Report{From: from, To: c.Now, Totals: []Trend{}, Daily: []Usage{}}
+	for _, t := range totals {
+		if t.PreviousJobMinutes > 0 {
+			change := float64(t.JobMinutes-t.PreviousJobMinutes) / float64(t.PreviousJobMinutes)
+			t.Change = &change
+		}
+		r.Totals = append(r.Totals, *t)
+	}
+	for _, d := range daily {
+		r.Daily = append(r.Daily, *d)
+	}
+	sort.Slice(r.Totals, func(i, j int) bool {
+		a, b := r.Totals[i], r.Totals[j]
+		if a.JobMinutes != b.JobMinutes {
+			return a.JobMinutes > b.JobMinutes
+		}
+		return a.Workflow+a.Event < b.Workflow+b.Event
+	})
+	sort.Slice(r.Daily, func(i, j int) bool {
+		a, b := r.Daily[i], r.Daily[j]
+		if a.Workflow != b.Workflow {
+			return a.Workflow < b.Workflow
+		}
+		if a.Event != b.Event {
+			return a.Event < b.Event
+		}
+		return a.Day < b.Day
+	})
+	return r, nil
+}
+
+// eachRun calls fn for the completed runs of workflow created between
+// since and the end of the period. Runs are listed newest first, so
+// listing stops at the first run created before since.
+func (c *Config) eachRun(ctx context.Context, workflow string, since time.Time, fn func(*github.WorkflowRun) error) error {
+	opts := &github.ListWorkflowRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := c.GitHub.Actions.ListWorkflowRunsByFileName(ctx, c.Organization, c.Repository, workflow, opts)
+		if err != nil {
+			return err
+		}
+		for _, run := range page.WorkflowRuns {
+			created := run.GetCreatedAt().Time
+			if created.Before(since) {
+				return nil
+			}
+			if created.After(c.Now) || run.GetStatus() != "completed" {
+				continue
+			}
+			if err := fn(run); err != nil {
+				return err
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// runUsage returns the usage of a single run.
+func (c *Config) runUsage(ctx context.Context, workflow string, run *github.WorkflowRun) (Usage, error) {
+	u := Usage{
+		Workflow: workflow,
+		Event:    run.GetEvent(),
+		Day:      run.GetCreatedAt().UTC().Format("2006-01-02"),
+		Runs:     1,
+	}
+	timing, _, err := c.GitHub.Actions.GetWorkflowRunUsageByID(ctx, c.Organization, c.Repository, run.GetID())
+	if err != nil {
+		return Usage{}, err
+	}
+	u.DurationMinutes = float64(timing.GetRunDurationMS()) / float64(time.Minute/time.Millisecond)
+	if env := timing.GetBillable(); env != nil {
+		for _, bill := range []*github.WorkflowRunBill{env.Ubuntu, env.MacOS, env.Windows} {
+			if bill != nil {
+				u.BillableMinutes += float64(bill.GetTotalMS()) / float64(time.Minute/time.Millisecond)
+			}
+		}
+	}
+
+	// Jobs of every attempt are billed.
+	opts := &github.ListWorkflowJobsOptions{Filter: "all", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		jobs, resp, err := c.GitHub.Actions.ListWorkflowJobs(ctx, c.Organization, c.Repository, run.GetID(), opts)
+		if err != nil {
+			return Usage{}, err
+		}
+		for _, job := range jobs.Jobs {
+			if job.StartedAt == nil || job.CompletedAt == nil {
+				continue
+			}
+			d := job.GetCompletedAt().Sub(job.GetStartedAt().Time)
+			u.Jobs++
+			u.JobMinutes += int64(math.Ceil(d.Minutes()))
+		}
+		if resp.NextPage == 0 {
+			return u, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
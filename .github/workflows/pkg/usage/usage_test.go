@@ -0,0 +1,96 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/client"
+	"github.com/gravitational/gh-actions-poc/.github/workflows/pkg/githubtest"
+)
+
+func TestCollect(t *testing.T) {
+	srv := githubtest.NewServer("gravitational", "teleport")
+	defer srv.Close()
+	now := time.Date(2021, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	// run adds a completed run of check.yml created days before now, with
+	// a job per duration.
+	run := func(event string, days float64, durations ...time.Duration) {
+		created := now.Add(-time.Duration(days * float64(24*time.Hour)))
+		r := githubtest.Run{
+			WorkflowID: 1,
+			Path:       ".github/workflows/check.yml",
+			Name:       "Check",
+			Event:      event,
+			HeadSHA:    "aaa111",
+			Status:     "completed",
+			Conclusion: "success",
+			Created:    created,
+			DurationMS: 90000,
+		}
+		for _, d := range durations {
+			r.Jobs = append(r.Jobs, githubtest.Job{Name: "build", Conclusion: "success", Started: created, Completed: created.Add(d)})
+		}
+		srv.AddRun(r)
+	}
+	run("pull_request_target", 1, 30*time.Second, 90*time.Second)
+	run("pull_request_target", 0.25, 2*time.Minute)
+	run("pull_request_review", 2, time.Minute)
+	// The period before.
+	run("pull_request_target", 8, 2*time.Minute)
+	// Too old to be reported.
+	run("pull_request_target", 15, time.Hour)
+	// Not completed yet.
+	srv.AddRun(githubtest.Run{WorkflowID: 1, Path: ".github/workflows/check.yml", Event: "pull_request_target", Status: "in_progress", Created: now.Add(-time.Hour)})
+
+	gh, err := client.New(client.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Collect(context.Background(), Config{
+		GitHub:       gh,
+		Organization: "gravitational",
+		Repository:   "teleport",
+		Workflows:    []string{"check.yml"},
+		Now:          now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.From.Equal(now.AddDate(0, 0, -7)) {
+		t.Errorf("report from %v, want the default of 7 days", report.From)
+	}
+	if len(report.Totals) != 2 {
+		t.Fatalf("got %v totals, want 2: %+v", len(report.Totals), report.Totals)
+	}
+	target, review := report.Totals[0], report.Totals[1]
+	// Jobs are rounded up to whole minutes: 1 + 2 + 2.
+	if target.Event != "pull_request_target" || target.Runs != 2 || target.Jobs != 3 || target.JobMinutes != 5 {
+		t.Errorf("got pull_request_target totals %+v, want 2 runs and 3 jobs of 5 minutes", target.Usage)
+	}
+	if target.PreviousRuns != 1 || target.PreviousJobMinutes != 2 || target.Change == nil || *target.Change != 1.5 {
+		t.Errorf("got pull_request_target trend %+v, want 1 previous run of 2 minutes", target)
+	}
+	if review.Event != "pull_request_review" || review.JobMinutes != 1 || review.Change != nil {
+		t.Errorf("got pull_request_review totals %+v, want 1 minute and no change", review)
+	}
+	if len(report.Daily) != 3 {
+		t.Errorf("got %v days, want 3: %+v", len(report.Daily), report.Daily)
+	}
+
+	var out bytes.Buffer
+	if err := report.Write(&out, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1+len(report.Totals)+len(report.Daily) {
+		t.Errorf("got %v CSV lines, want a header, the totals and the days:\n%v", len(lines), out.String())
+	}
+	if want := "check.yml,pull_request_target,total,2,3,5,"; !strings.HasPrefix(lines[1], want) {
+		t.Errorf("got CSV totals %q, want prefix %q", lines[1], want)
+	}
+}
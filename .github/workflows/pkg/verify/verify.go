@@ -0,0 +1,87 @@
+// Package verify checks commit signatures with gpg.
+//
+// Keys are not managed here: the workflow imports GitHub's web-flow key
+// (https://github.com/web-flow.gpg) into the runner's keyring before the
+// bot runs.
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+)
+
+// WebFlowLogin is the account GitHub commits as when changes are made
+// through its web interface, e.g. by "Update branch" or applied suggestions.
+const WebFlowLogin = "web-flow"
+
+// Signature verifies a detached armored signature over payload against the
+// keys in the local gpg keyring.
+func Signature(signature, payload string) error {
+	dataFile, err := writeTemp("data", payload)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dataFile)
+	sigFile, err := writeTemp("signature", signature)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sigFile)
+
+	cmd := exec.Command("gpg", "--verify", sigFile, dataFile)
+	var errout bytes.Buffer
+	cmd.Stderr = &errout
+	if err := cmd.Run(); err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("gpg exited with %v: %v", exitError.ExitCode(), strings.TrimSpace(errout.String()))
+		}
+		return err
+	}
+	return nil
+}
+
+// Commit verifies the signature of commit.
+func Commit(commit *github.RepositoryCommit) error {
+	v := commit.GetCommit().GetVerification()
+	if v.GetSignature() == "" {
+		return fmt.Errorf("commit %v is not signed", commit.GetSHA())
+	}
+	return Signature(v.GetSignature(), v.GetPayload())
+}
+
+// IsWebFlow reports whether commit was created by GitHub itself rather
+// than pushed by a user: it must be committed by web-flow and carry a
+// signature that verifies against the web-flow key.
+func IsWebFlow(commit *github.RepositoryCommit) bool {
+	if commit.GetCommitter().GetLogin() != WebFlowLogin {
+		return false
+	}
+	if !commit.GetCommit().GetVerification().GetVerified() {
+		return false
+	}
+	return Commit(commit) == nil
+}
+
+// writeTemp writes content to a new temporary file and returns its name.
+func writeTemp(prefix, content string) (string, error) {
+	f, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
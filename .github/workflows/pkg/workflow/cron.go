@@ -0,0 +1,246 @@
+package workflow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed POSIX cron expression, as used by schedule triggers.
+// Schedules run in UTC.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day of month or week. When both days
+	// are restricted, a day matching either runs, as in cron(8).
+	domAny, dowAny bool
+}
+
+// cronField describes a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is accepted for Sunday, like 0.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// ParseCron parses a five field cron expression. Fields may be "*",
+// numbers, ranges ("1-5"), steps ("*/15", "0-30/10") and lists of these
+// ("1,15"). Months and days of the week may also be given by their three
+// letter English names.
+func ParseCron(spec string) (*Cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q has %v fields, want %v: minute hour day-of-month month day-of-week", spec, len(fields), len(cronFields))
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := cronFields[i].parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %v", spec, err)
+		}
+		sets[i] = set
+	}
+	c := &Cron{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	// Fold Sunday as 7 onto 0.
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	return c, nil
+}
+
+// parse parses a field into a bit set of the values it matches.
+func (f cronField) parse(field string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%v: invalid step in %q", f.name, part)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err error
+			if lo, err = f.value(rng[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(rng[i+1:]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%v: range %q is backwards", f.name, rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "5/15" means from 5 to the maximum in steps of 15.
+			if step == 1 {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// value parses a single value of the field.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%v: invalid value %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%v: %v is out of range %v-%v", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t the schedule runs, or the zero time
+// if it never does, as for "0 0 31 2 *".
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every schedule that can run does so within a leap year cycle.
+	end := t.AddDate(8, 0, 0)
+	for t.Before(end) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Runs returns the next n times after t the schedule runs.
+func (c *Cron) Runs(t time.Time, n int) []time.Time {
+	var runs []time.Time
+	for len(runs) < n {
+		if t = c.Next(t); t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs
+}
+
+// Interval returns the time between runs if the schedule runs at a fixed
+// interval from t on, judged by its next runs, or 0.
+func (c *Cron) Interval(t time.Time) time.Duration {
+	runs := c.Runs(t, 50)
+	if len(runs) < 2 {
+		return 0
+	}
+	d := runs[1].Sub(runs[0])
+	for i := 2; i < len(runs); i++ {
+		if runs[i].Sub(runs[i-1]) != d {
+			return 0
+		}
+	}
+	return d
+}
+
+// MinInterval returns the shortest time between the next runs after t.
+func (c *Cron) MinInterval(t time.Time) time.Duration {
+	runs := c.Runs(t, 50)
+	var min time.Duration
+	for i := 1; i < len(runs); i++ {
+		if d := runs[i].Sub(runs[i-1]); min == 0 || d < min {
+			min = d
+		}
+	}
+	return min
+}
+
+// describeInterval returns d in words, as in "every 5 minutes".
+func describeInterval(d time.Duration) string {
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{7 * 24 * time.Hour, "week"},
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+	}
+	for _, u := range units {
+		if d%u.d == 0 {
+			if n := d / u.d; n != 1 {
+				return fmt.Sprintf("every %v %vs", int64(n), u.name)
+			}
+			return "every " + u.name
+		}
+	}
+	return "every " + d.String()
+}
+
+// Describe returns a preview of the schedule from t on, as in "every 5
+// minutes, next at 2021-10-12 10:05 UTC".
+func (c *Cron) Describe(t time.Time) string {
+	next := c.Next(t)
+	if next.IsZero() {
+		return "never runs"
+	}
+	when := "next at " + next.Format("2006-01-02 15:04 MST")
+	if d := c.Interval(t); d != 0 {
+		return describeInterval(d) + ", " + when
+	}
+	var runs []string
+	for _, r := range c.Runs(t, 3) {
+		runs = append(runs, r.Format("Mon 2006-01-02 15:04 MST"))
+	}
+	return "next at " + strings.Join(runs, ", ")
+}
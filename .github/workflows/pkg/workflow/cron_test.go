@@ -0,0 +1,86 @@
+package workflow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2021, 10, 12, 10, 2, 0, 0, time.UTC) // A Tuesday.
+	tests := []struct {
+		spec string
+		// next are the next runs after from, in "2006-01-02 15:04".
+		next []string
+		err  string
+	}{
+		{spec: "*/5 * * * *", next: []string{"2021-10-12 10:05", "2021-10-12 10:10"}},
+		{spec: "0 */6 * * *", next: []string{"2021-10-12 12:00", "2021-10-12 18:00"}},
+		{spec: "30 9 * * mon-fri", next: []string{"2021-10-13 09:30", "2021-10-14 09:30"}},
+		{spec: "0 0 * * 7", next: []string{"2021-10-17 00:00", "2021-10-24 00:00"}},
+		{spec: "0 0 1,15 jan,oct *", next: []string{"2021-10-15 00:00", "2022-01-01 00:00"}},
+		{spec: "5/20 10 * * *", next: []string{"2021-10-12 10:05", "2021-10-12 10:25"}},
+		// With both days restricted, either runs.
+		{spec: "0 0 13 * fri", next: []string{"2021-10-13 00:00", "2021-10-15 00:00"}},
+		{spec: "0 0 29 2 *", next: []string{"2024-02-29 00:00", "2028-02-29 00:00"}},
+		{spec: "0 0 31 2 *"},
+		{spec: "0 0 * *", err: `cron "0 0 * *" has 4 fields, want 5: minute hour day-of-month month day-of-week`},
+		{spec: "60 * * * *", err: `cron "60 * * * *": minute: 60 is out of range 0-59`},
+		{spec: "* * * * 8", err: `cron "* * * * 8": day of week: 8 is out of range 0-7`},
+		{spec: "*/0 * * * *", err: `cron "*/0 * * * *": minute: invalid step in "*/0"`},
+		{spec: "0 5-1 * * *", err: `cron "0 5-1 * * *": hour: range "5-1" is backwards`},
+		{spec: "0 0 * foo *", err: `cron "0 0 * foo *": month: invalid value "foo"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := ParseCron(tt.spec)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var next []string
+			for _, r := range c.Runs(from, len(tt.next)+1) {
+				next = append(next, r.Format("2006-01-02 15:04"))
+			}
+			if len(tt.next) == 0 && len(next) != 0 {
+				t.Fatalf("got runs %v, want none", next)
+			}
+			for i := range tt.next {
+				if i >= len(next) || next[i] != tt.next[i] {
+					t.Fatalf("got runs %v, want %v first", next, tt.next)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	from := time.Date(2021, 10, 12, 10, 2, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{spec: "* * * * *", want: "every minute, next at 2021-10-12 10:03 UTC"},
+		{spec: "*/5 * * * *", want: "every 5 minutes, next at 2021-10-12 10:05 UTC"},
+		{spec: "0 * * * *", want: "every hour, next at 2021-10-12 11:00 UTC"},
+		{spec: "0 0 * * *", want: "every day, next at 2021-10-13 00:00 UTC"},
+		{spec: "0 0 * * sun", want: "every week, next at 2021-10-17 00:00 UTC"},
+		{spec: "0 9,17 * * *", want: "next at Tue 2021-10-12 17:00 UTC, Wed 2021-10-13 09:00 UTC, Wed 2021-10-13 17:00 UTC"},
+		{spec: "0 0 31 2 *", want: "never runs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Describe(from); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
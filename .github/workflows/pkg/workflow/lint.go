@@ -0,0 +1,206 @@
+package workflow
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is the security baseline workflows are linted against.
+type Policy struct {
+	// DefaultBranch is the only ref privileged workflows, triggered by
+	// pull_request_target or workflow_run, may check out.
+	DefaultBranch string
+	// Permissions maps GITHUB_TOKEN scopes to the highest level, "read",
+	// "write" or "none", workflows may grant. Scopes listed as "none" or
+	// not listed at all may not be granted.
+	Permissions map[string]string
+}
+
+// Rules reported by Lint.
+const (
+	// RuleTargetCheckout flags pull_request_target and workflow_run
+	// workflows checking out anything but the default branch. Such
+	// workflows run with secrets and a write token even for pull requests
+	// from forks, so they must not run code from the pull request.
+	RuleTargetCheckout = "target-checkout"
+	// RulePermissions flags permissions broader than the baseline.
+	RulePermissions = "permissions"
+	// RuleSecretInRun flags secrets interpolated into shell scripts, where
+	// they end up in the script file and process list. They should be
+	// passed through env instead.
+	RuleSecretInRun = "secret-in-run"
+	// RuleInjection flags event data interpolated into scripts. Titles,
+	// branch names and the like are attacker controlled and can inject
+	// commands.
+	RuleInjection = "expression-injection"
+)
+
+var (
+	expression = regexp.MustCompile(`\$\{\{(.*?)\}\}`)
+	secretRef  = regexp.MustCompile(`\bsecrets\.`)
+	eventRef   = regexp.MustCompile(`\bgithub\.(event\.|head_ref\b)`)
+	// headRef matches checkout refs naming the pull request's code.
+	headRef = regexp.MustCompile(`github\.event\.pull_request\.head|github\.event\.workflow_run\.head|github\.head_ref|refs/pull/|pull_request\.merge`)
+	// headRepo matches checkout repositories naming the pull request's fork.
+	headRepo = regexp.MustCompile(`github\.event\.pull_request\.head|github\.event\.workflow_run\.head_repository`)
+)
+
+// privilegedTriggers run with secrets and a write token even when started
+// by a pull request from a fork.
+var privilegedTriggers = []string{"pull_request_target", "workflow_run"}
+
+// levels ranks permission levels.
+var levels = map[string]int{"none": 0, "read": 1, "write": 2}
+
+// Lint checks a workflow against the policy.
+func Lint(f *File, p Policy) []Problem {
+	var problems []Problem
+	problems = append(problems, f.lintPermissions(p)...)
+	var trigger string
+	triggers := f.Triggers()
+	for _, t := range privilegedTriggers {
+		if _, ok := triggers[t]; ok {
+			trigger = t
+			break
+		}
+	}
+	for _, job := range f.Jobs() {
+		_, perms := lookup(job.Node, "permissions")
+		if perms != nil {
+			problems = append(problems, f.checkPermissions(perms, p)...)
+		}
+		for _, step := range job.Steps() {
+			uses := value(step, "uses")
+			if trigger != "" && strings.HasPrefix(uses, "actions/checkout@") {
+				problems = append(problems, f.lintCheckout(step, trigger, p)...)
+			}
+			if _, run := lookup(step, "run"); run != nil {
+				problems = append(problems, f.lintScript(run)...)
+			}
+			if strings.HasPrefix(uses, "actions/github-script@") {
+				_, with := lookup(step, "with")
+				if _, script := lookup(with, "script"); script != nil {
+					problems = append(problems, f.lintScript(script)...)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// lintPermissions checks the workflow's permissions. Without a
+// permissions block, GITHUB_TOKEN gets the repository's default
+// permissions, which may be read and write to everything.
+func (f *File) lintPermissions(p Policy) []Problem {
+	if _, perms := lookup(f.Root, "permissions"); perms != nil {
+		return f.checkPermissions(perms, p)
+	}
+	var problems []Problem
+	for _, job := range f.Jobs() {
+		if k, _ := lookup(job.Node, "permissions"); k == nil {
+			problems = append(problems, f.problem(job.Key, RulePermissions,
+				"job %q has no permissions and the workflow sets none, granting the repository's default token permissions", job.ID))
+		}
+	}
+	return problems
+}
+
+// checkPermissions checks a workflow or job permissions node.
+func (f *File) checkPermissions(perms *yaml.Node, p Policy) []Problem {
+	switch perms.Kind {
+	case yaml.ScalarNode:
+		switch perms.Value {
+		case "read-all", "write-all":
+			return []Problem{f.problem(perms, RulePermissions,
+				"%v grants every scope, list the scopes needed instead", perms.Value)}
+		}
+		return nil
+	case yaml.MappingNode:
+		var problems []Problem
+		for i := 0; i+1 < len(perms.Content); i += 2 {
+			scope, level := perms.Content[i].Value, perms.Content[i+1]
+			allowed := p.Permissions[scope]
+			if allowed == "" {
+				allowed = "none"
+			}
+			if levels[level.Value] > levels[allowed] {
+				problems = append(problems, f.problem(level, RulePermissions,
+					"%v: %v exceeds the baseline of %v", scope, level.Value, allowed))
+			}
+		}
+		return problems
+	}
+	return nil
+}
+
+// lintCheckout checks a checkout step of a workflow run by a privileged
+// trigger.
+func (f *File) lintCheckout(step *yaml.Node, trigger string, p Policy) []Problem {
+	_, with := lookup(step, "with")
+	var problems []Problem
+	if _, repo := lookup(with, "repository"); repo != nil && headRepo.MatchString(repo.Value) {
+		problems = append(problems, f.problem(repo, RuleTargetCheckout,
+			"checks out the pull request's fork in a %v workflow, running untrusted code with secrets", trigger))
+	}
+	_, ref := lookup(with, "ref")
+	switch {
+	case ref == nil:
+		// Without a ref, both triggers check out the default branch.
+	case headRef.MatchString(ref.Value):
+		problems = append(problems, f.problem(ref, RuleTargetCheckout,
+			"checks out the pull request head in a %v workflow, running untrusted code with secrets", trigger))
+	case ref.Value != p.DefaultBranch && ref.Value != "refs/heads/"+p.DefaultBranch:
+		problems = append(problems, f.problem(ref, RuleTargetCheckout,
+			"checks out %q rather than the default branch %q in a %v workflow", ref.Value, p.DefaultBranch, trigger))
+	}
+	return problems
+}
+
+// lintScript checks the expressions interpolated into a script.
+func (f *File) lintScript(script *yaml.Node) []Problem {
+	var problems []Problem
+	// from is where the search for the next expression in the source
+	// starts. Block scalars start on the line after their indicator.
+	from := &yaml.Node{Line: script.Line, Column: script.Column}
+	if script.Style == yaml.LiteralStyle || script.Style == yaml.FoldedStyle {
+		from = &yaml.Node{Line: script.Line + 1, Column: 1}
+	}
+	for _, loc := range expression.FindAllStringSubmatchIndex(script.Value, -1) {
+		expr := script.Value[loc[2]:loc[3]]
+		at := f.sourcePosition(script, script.Value[loc[0]:loc[1]], from)
+		switch {
+		case secretRef.MatchString(expr):
+			problems = append(problems, f.problem(at, RuleSecretInRun,
+				"${{%v}} interpolates a secret into the script, pass it through env instead", expr))
+		case eventRef.MatchString(expr):
+			problems = append(problems, f.problem(at, RuleInjection,
+				"${{%v}} interpolates event data into the script, pass it through env instead", expr))
+		}
+	}
+	return problems
+}
+
+// sourcePosition returns a node positioned at the first occurrence of text
+// in the source at or after from, and moves from past it. Scalar values
+// lose their indentation and folded lines are joined, so positions in the
+// value do not map to the source. Text not found in the source, such as
+// text with escapes in a quoted scalar, is reported at the scalar.
+func (f *File) sourcePosition(script *yaml.Node, text string, from *yaml.Node) *yaml.Node {
+	for line := from.Line; line <= len(f.lines); line++ {
+		src, start := f.lines[line-1], 0
+		if line == from.Line {
+			start = from.Column - 1
+		}
+		if start > len(src) {
+			continue
+		}
+		if i := strings.Index(src[start:], text); i >= 0 {
+			at := &yaml.Node{Line: line, Column: start + i + 1}
+			from.Line, from.Column = line, at.Column+len(text)
+			return at
+		}
+	}
+	return script
+}
@@ -0,0 +1,226 @@
+package workflow
+
+import "testing"
+
+func TestLintCheckout(t *testing.T) {
+	policy := Policy{DefaultBranch: "master", Permissions: map[string]string{"actions": "write"}}
+	tests := []struct {
+		desc string
+		on   string
+		with string
+		want []string
+	}{
+		{
+			desc: "pull_request_target without ref",
+			on:   "pull_request_target",
+		},
+		{
+			desc: "pull_request_target checking out another branch",
+			on:   "pull_request_target",
+			with: "ref: dev",
+			want: []string{`wf.yml:11:16: target-checkout: checks out "dev" rather than the default branch "master" in a pull_request_target workflow`},
+		},
+		{
+			desc: "pull_request_target checking out the head",
+			on:   "pull_request_target",
+			with: "ref: ${{ github.event.pull_request.head.sha }}",
+			want: []string{"wf.yml:11:16: target-checkout: checks out the pull request head in a pull_request_target workflow, running untrusted code with secrets"},
+		},
+		{
+			desc: "workflow_run without ref",
+			on:   "workflow_run",
+		},
+		{
+			desc: "workflow_run checking out the default branch",
+			on:   "workflow_run",
+			with: "ref: refs/heads/master",
+		},
+		{
+			desc: "workflow_run checking out another branch",
+			on:   "workflow_run",
+			with: "ref: dev",
+			want: []string{`wf.yml:11:16: target-checkout: checks out "dev" rather than the default branch "master" in a workflow_run workflow`},
+		},
+		{
+			desc: "workflow_run checking out the head",
+			on:   "workflow_run",
+			with: "ref: ${{ github.event.workflow_run.head_sha }}",
+			want: []string{"wf.yml:11:16: target-checkout: checks out the pull request head in a workflow_run workflow, running untrusted code with secrets"},
+		},
+		{
+			desc: "workflow_run checking out the fork",
+			on:   "workflow_run",
+			with: "repository: ${{ github.event.workflow_run.head_repository.full_name }}",
+			want: []string{"wf.yml:11:23: target-checkout: checks out the pull request's fork in a workflow_run workflow, running untrusted code with secrets"},
+		},
+		{
+			desc: "pull_request checking out another branch",
+			on:   "pull_request",
+			with: "ref: dev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			with := " {}"
+			if tt.with != "" {
+				with = "\n          " + tt.with
+			}
+			data := "on:\n  " + tt.on + ":\n" + `permissions:
+  actions: write
+jobs:
+  job:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v2
+        with:` + with + "\n"
+			f, err := Parse("wf.yml", []byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range Lint(f, policy) {
+				got = append(got, p.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got problems %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLintPermissions(t *testing.T) {
+	policy := Policy{DefaultBranch: "master", Permissions: map[string]string{"contents": "read", "issues": "none", "pull-requests": "write"}}
+	tests := []struct {
+		desc string
+		data string
+		want []string
+	}{
+		{
+			desc: "within the baseline",
+			data: "on: push\npermissions:\n  contents: read\n  issues: none\n  pull-requests: write\njobs:\n  job:\n    runs-on: ubuntu-latest\n",
+		},
+		{
+			desc: "write beyond read",
+			data: "on: push\npermissions:\n  contents: write\njobs:\n  job:\n    runs-on: ubuntu-latest\n",
+			want: []string{"wf.yml:3:13: permissions: contents: write exceeds the baseline of read"},
+		},
+		{
+			desc: "scope listed as none",
+			data: "on: push\npermissions:\n  issues: read\njobs:\n  job:\n    runs-on: ubuntu-latest\n",
+			want: []string{"wf.yml:3:11: permissions: issues: read exceeds the baseline of none"},
+		},
+		{
+			desc: "scope not listed",
+			data: "on: push\npermissions:\n  packages: read\njobs:\n  job:\n    runs-on: ubuntu-latest\n",
+			want: []string{"wf.yml:3:13: permissions: packages: read exceeds the baseline of none"},
+		},
+		{
+			desc: "every scope",
+			data: "on: push\npermissions: write-all\njobs:\n  job:\n    runs-on: ubuntu-latest\n",
+			want: []string{"wf.yml:2:14: permissions: write-all grants every scope, list the scopes needed instead"},
+		},
+		{
+			desc: "job beyond the baseline",
+			data: "on: push\npermissions:\n  contents: read\njobs:\n  job:\n    runs-on: ubuntu-latest\n    permissions:\n      contents: write\n",
+			want: []string{"wf.yml:8:17: permissions: contents: write exceeds the baseline of read"},
+		},
+		{
+			desc: "job without permissions",
+			data: "on: push\njobs:\n  job:\n    runs-on: ubuntu-latest\n  other:\n    runs-on: ubuntu-latest\n    permissions:\n      contents: read\n",
+			want: []string{`wf.yml:3:3: permissions: job "job" has no permissions and the workflow sets none, granting the repository's default token permissions`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			checkLint(t, tt.data, policy, tt.want)
+		})
+	}
+}
+
+func TestLintScript(t *testing.T) {
+	policy := Policy{DefaultBranch: "master"}
+	tests := []struct {
+		desc string
+		// step is a step of a job. Its first line, line 8, is indented by
+		// eight spaces and the others must be indented in full.
+		step string
+		want []string
+	}{
+		{
+			desc: "plain script",
+			step: "- run: echo ${{ github.event_name }} ${{ env.TOKEN }}",
+		},
+		{
+			desc: "secret",
+			step: "- run: curl -u ${{ secrets.TOKEN }} https://example.com",
+			want: []string{"wf.yml:8:24: secret-in-run: ${{ secrets.TOKEN }} interpolates a secret into the script, pass it through env instead"},
+		},
+		{
+			desc: "event data",
+			step: "- run: echo \"${{ github.event.pull_request.title }}\"",
+			want: []string{"wf.yml:8:22: expression-injection: ${{ github.event.pull_request.title }} interpolates event data into the script, pass it through env instead"},
+		},
+		{
+			desc: "head ref",
+			step: "- run: git checkout ${{ github.head_ref }}",
+			want: []string{"wf.yml:8:29: expression-injection: ${{ github.head_ref }} interpolates event data into the script, pass it through env instead"},
+		},
+		{
+			desc: "literal block",
+			step: "- run: |\n            echo start\n              echo ${{ secrets.TOKEN }} ${{ github.event.issue.title }}",
+			want: []string{
+				"wf.yml:10:20: secret-in-run: ${{ secrets.TOKEN }} interpolates a secret into the script, pass it through env instead",
+				"wf.yml:10:41: expression-injection: ${{ github.event.issue.title }} interpolates event data into the script, pass it through env instead",
+			},
+		},
+		{
+			desc: "folded block",
+			step: "- run: >\n            echo start\n            && echo ${{ github.event.comment.body }}",
+			want: []string{"wf.yml:10:21: expression-injection: ${{ github.event.comment.body }} interpolates event data into the script, pass it through env instead"},
+		},
+		{
+			desc: "github-script",
+			step: "- uses: actions/github-script@v5\n          with:\n            script: |\n              console.log(\"${{ github.event.review.body }}\")",
+			want: []string{"wf.yml:11:28: expression-injection: ${{ github.event.review.body }} interpolates event data into the script, pass it through env instead"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			data := `on: pull_request
+permissions:
+  contents: none
+jobs:
+  job:
+    runs-on: ubuntu-latest
+    steps:
+        ` + tt.step + "\n"
+			checkLint(t, data, policy, tt.want)
+		})
+	}
+}
+
+// checkLint lints the workflow in data and compares the problems to want.
+func checkLint(t *testing.T, data string, p Policy, want []string) {
+	t.Helper()
+	f, err := Parse("wf.yml", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range Lint(f, p) {
+		got = append(got, p.String())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got problems %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"gopkg.in/yaml.v3"
+)
+
+// RuleUnpinned flags actions referenced by a tag or branch. Tags and
+// branches can be moved to other code after review, commit SHAs cannot.
+const RuleUnpinned = "unpinned"
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Action is a reference to an action or reusable workflow in another
+// repository, as in "actions/checkout@v2".
+type Action struct {
+	// Node is the value of the "uses" key.
+	Node  *yaml.Node
+	Owner string
+	Repo  string
+	// Path is the directory or workflow file within the repository, if any.
+	Path string
+	// Ref is the tag, branch or commit SHA referenced.
+	Ref string
+}
+
+// Pinned returns whether the action is referenced by a full commit SHA.
+func (a Action) Pinned() bool {
+	return commitSHA.MatchString(a.Ref)
+}
+
+func (a Action) String() string {
+	return a.Node.Value
+}
+
+// Actions returns the actions the workflow's jobs and steps use. Local
+// actions ("./path") and Docker images ("docker://image") are skipped.
+func (f *File) Actions() []Action {
+	var nodes []*yaml.Node
+	for _, job := range f.Jobs() {
+		if _, uses := lookup(job.Node, "uses"); uses != nil {
+			nodes = append(nodes, uses)
+		}
+		for _, step := range job.Steps() {
+			if _, uses := lookup(step, "uses"); uses != nil {
+				nodes = append(nodes, uses)
+			}
+		}
+	}
+	var actions []Action
+	for _, n := range nodes {
+		if a, ok := parseAction(n); ok {
+			actions = append(actions, a)
+		}
+	}
+	return actions
+}
+
+// parseAction parses a "uses" value of the form owner/repo[/path]@ref.
+func parseAction(n *yaml.Node) (Action, bool) {
+	if n.Kind != yaml.ScalarNode || strings.HasPrefix(n.Value, "./") || strings.HasPrefix(n.Value, "docker://") {
+		return Action{}, false
+	}
+	i := strings.LastIndex(n.Value, "@")
+	if i < 0 {
+		return Action{}, false
+	}
+	parts := strings.SplitN(n.Value[:i], "/", 3)
+	if len(parts) < 2 {
+		return Action{}, false
+	}
+	a := Action{Node: n, Owner: parts[0], Repo: parts[1], Ref: n.Value[i+1:]}
+	if len(parts) == 3 {
+		a.Path = parts[2]
+	}
+	return a, true
+}
+
+// Unpinned reports the actions the workflow does not pin to a commit SHA.
+func Unpinned(f *File) []Problem {
+	var problems []Problem
+	for _, a := range f.Actions() {
+		if !a.Pinned() {
+			problems = append(problems, f.problem(a.Node, RuleUnpinned,
+				"%v is not pinned to a commit SHA", a))
+		}
+	}
+	return problems
+}
+
+// Resolver resolves a tag or branch of a repository to a commit SHA.
+type Resolver func(ctx context.Context, owner, repo, ref string) (string, error)
+
+// NewResolver returns a Resolver looking refs up through the GitHub API.
+// Results are cached, as workflows tend to use the same actions.
+func NewResolver(gh *github.Client) Resolver {
+	cache := map[string]string{}
+	return func(ctx context.Context, owner, repo, ref string) (string, error) {
+		key := strings.ToLower(owner + "/" + repo + "@" + ref)
+		if sha, ok := cache[key]; ok {
+			return sha, nil
+		}
+		// GetCommitSHA1 peels annotated tags to the commit they point at,
+		// which Git.GetRef would return as a tag object.
+		sha, _, err := gh.Repositories.GetCommitSHA1(ctx, owner, repo, ref, "")
+		if err != nil {
+			return "", fmt.Errorf("resolving %v/%v@%v: %v", owner, repo, ref, err)
+		}
+		cache[key] = sha
+		return sha, nil
+	}
+}
+
+// Pin rewrites the unpinned actions of the workflow to the commit SHA
+// their ref resolves to, keeping the ref in a trailing comment, as in
+// "actions/checkout@<sha> # v2". Only the references are edited, leaving
+// the rest of the file as it was. It returns the number of actions pinned;
+// call Save to write them.
+func (f *File) Pin(ctx context.Context, resolve Resolver) (int, error) {
+	pinned := 0
+	for _, a := range f.Actions() {
+		if a.Pinned() {
+			continue
+		}
+		sha, err := resolve(ctx, a.Owner, a.Repo, a.Ref)
+		if err != nil {
+			return pinned, err
+		}
+		if err := f.pin(a, sha); err != nil {
+			return pinned, err
+		}
+		pinned++
+	}
+	return pinned, nil
+}
+
+// pin replaces the ref of a on its source line with sha.
+func (f *File) pin(a Action, sha string) error {
+	n := a.Node
+	if n.Line > len(f.lines) {
+		return fmt.Errorf("%v:%v: line out of range", f.Path, n.Line)
+	}
+	line := f.lines[n.Line-1]
+	start := n.Column - 1
+	if start > len(line) {
+		start = len(line)
+	}
+	i := strings.Index(line[start:], n.Value)
+	if i < 0 {
+		return fmt.Errorf("%v:%v:%v: %v not found on its line", f.Path, n.Line, n.Column, n.Value)
+	}
+	i += start
+	ref := strings.TrimSuffix(n.Value, a.Ref) + sha
+	line = line[:i] + ref + line[i+len(n.Value):]
+
+	// Keep the ref as a comment, in front of any existing one.
+	cr := strings.HasSuffix(line, "\r")
+	line = strings.TrimRight(line, " \t\r")
+	if n.LineComment != "" && strings.HasSuffix(line, n.LineComment) {
+		comment := strings.TrimSpace(strings.TrimPrefix(n.LineComment, "#"))
+		line = strings.TrimSuffix(line, n.LineComment) + "# " + a.Ref + ": " + comment
+	} else {
+		line += " # " + a.Ref
+	}
+	if cr {
+		line += "\r"
+	}
+	f.lines[n.Line-1] = line
+	return nil
+}
+
+// Save writes the workflow, with any changes made by Pin, back to Path.
+func (f *File) Save() error {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Path, []byte(strings.Join(f.lines, "\n")), info.Mode())
+}
@@ -0,0 +1,103 @@
+package workflow
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPin(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	const pinnedSHA = "89abcdef0123456789abcdef0123456789abcdef"
+	// The odd spacing, quoting and comments must survive pinning.
+	const before = `on: push
+permissions:   {}   # None.
+jobs:
+  reusable:
+    uses: octo-org/workflows/.github/workflows/build.yml@main
+  job:
+    runs-on: ubuntu-latest
+    steps:
+      -   uses:   actions/checkout@v2
+      - uses: "actions/setup-go@v2"   # Go 1.16.
+      - uses: ./.github/actions/local
+      - uses: docker://alpine:3.14
+      - uses: actions/cache@` + pinnedSHA + ` # v2
+      - run: echo actions/checkout@v2
+`
+	const after = `on: push
+permissions:   {}   # None.
+jobs:
+  reusable:
+    uses: octo-org/workflows/.github/workflows/build.yml@` + sha + ` # main
+  job:
+    runs-on: ubuntu-latest
+    steps:
+      -   uses:   actions/checkout@` + sha + ` # v2
+      - uses: "actions/setup-go@` + sha + `"   # v2: Go 1.16.
+      - uses: ./.github/actions/local
+      - uses: docker://alpine:3.14
+      - uses: actions/cache@` + pinnedSHA + ` # v2
+      - run: echo actions/checkout@v2
+`
+	path := filepath.Join(t.TempDir(), "wf.yml")
+	if err := ioutil.WriteFile(path, []byte(before), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unpinned []string
+	for _, p := range Unpinned(f) {
+		unpinned = append(unpinned, p.String())
+	}
+	want := []string{
+		path + ":5:11: unpinned: octo-org/workflows/.github/workflows/build.yml@main is not pinned to a commit SHA",
+		path + ":9:19: unpinned: actions/checkout@v2 is not pinned to a commit SHA",
+		path + ":10:15: unpinned: actions/setup-go@v2 is not pinned to a commit SHA",
+	}
+	if strings.Join(unpinned, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems %q, want %q", unpinned, want)
+	}
+
+	var resolved []string
+	resolve := func(ctx context.Context, owner, repo, ref string) (string, error) {
+		resolved = append(resolved, owner+"/"+repo+"@"+ref)
+		return sha, nil
+	}
+	n, err := f.Pin(context.Background(), resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("pinned %v actions, want 3", n)
+	}
+	if want := "octo-org/workflows@main actions/checkout@v2 actions/setup-go@v2"; strings.Join(resolved, " ") != want {
+		t.Errorf("resolved %v, want %v", resolved, want)
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != after {
+		t.Errorf("got pinned workflow:\n%v\nwant:\n%v", string(data), after)
+	}
+
+	// The pinned workflow has nothing left to pin.
+	if f, err = Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if problems := Unpinned(f); len(problems) != 0 {
+		t.Errorf("got problems %v after pinning, want none", problems)
+	}
+	if n, err := f.Pin(context.Background(), resolve); err != nil || n != 0 {
+		t.Errorf("pinned %v actions again (%v), want 0", n, err)
+	}
+}
@@ -0,0 +1,85 @@
+package workflow
+
+// The workflow syntax checked by Validate, after
+// https://docs.github.com/en/actions/reference/workflow-syntax-for-github-actions
+// and
+// https://docs.github.com/en/actions/reference/events-that-trigger-workflows.
+
+// workflowKeys are the keys allowed at the top of a workflow.
+var workflowKeys = keySet("name", "run-name", "on", "permissions", "env", "defaults", "concurrency", "jobs")
+
+// jobKeys are the keys allowed in a job.
+var jobKeys = keySet("name", "needs", "permissions", "runs-on", "environment", "concurrency", "outputs",
+	"env", "defaults", "if", "steps", "timeout-minutes", "strategy", "continue-on-error", "container",
+	"services", "uses", "with", "secrets")
+
+// stepKeys are the keys allowed in a step.
+var stepKeys = keySet("id", "if", "name", "uses", "run", "shell", "with", "env", "continue-on-error",
+	"timeout-minutes", "working-directory")
+
+// permissionScopes are the GITHUB_TOKEN permission scopes.
+var permissionScopes = keySet("actions", "checks", "contents", "deployments", "discussions", "id-token",
+	"issues", "packages", "pages", "pull-requests", "repository-projects", "security-events", "statuses")
+
+// event describes a trigger.
+type event struct {
+	// types are the activity types the event may be filtered by. An empty
+	// set allows any type, nil allows no filter.
+	types map[string]bool
+	// keys are the other configuration keys the event accepts.
+	keys map[string]bool
+}
+
+var (
+	pullRequestTypes = keySet("assigned", "unassigned", "labeled", "unlabeled", "opened", "edited", "closed",
+		"reopened", "synchronize", "converted_to_draft", "ready_for_review", "locked", "unlocked",
+		"review_requested", "review_request_removed", "auto_merge_enabled", "auto_merge_disabled")
+	pullRequestKeys = keySet("branches", "branches-ignore", "paths", "paths-ignore")
+)
+
+// events are the events workflows can be triggered by.
+var events = map[string]event{
+	"branch_protection_rule":      {types: keySet("created", "edited", "deleted")},
+	"check_run":                   {types: keySet("created", "rerequested", "completed", "requested_action")},
+	"check_suite":                 {types: keySet("completed", "requested", "rerequested")},
+	"create":                      {},
+	"delete":                      {},
+	"deployment":                  {},
+	"deployment_status":           {},
+	"discussion":                  {types: keySet("created", "edited", "deleted", "transferred", "pinned", "unpinned", "labeled", "unlabeled", "locked", "unlocked", "category_changed", "answered", "unanswered")},
+	"discussion_comment":          {types: keySet("created", "edited", "deleted")},
+	"fork":                        {},
+	"gollum":                      {},
+	"issue_comment":               {types: keySet("created", "edited", "deleted")},
+	"issues":                      {types: keySet("opened", "edited", "deleted", "transferred", "pinned", "unpinned", "closed", "reopened", "assigned", "unassigned", "labeled", "unlabeled", "locked", "unlocked", "milestoned", "demilestoned")},
+	"label":                       {types: keySet("created", "edited", "deleted")},
+	"milestone":                   {types: keySet("created", "closed", "opened", "edited", "deleted")},
+	"page_build":                  {},
+	"project":                     {types: keySet("created", "updated", "closed", "reopened", "edited", "deleted")},
+	"project_card":                {types: keySet("created", "moved", "converted", "edited", "deleted")},
+	"project_column":              {types: keySet("created", "updated", "moved", "deleted")},
+	"public":                      {},
+	"pull_request":                {types: pullRequestTypes, keys: pullRequestKeys},
+	"pull_request_review":         {types: keySet("submitted", "edited", "dismissed")},
+	"pull_request_review_comment": {types: keySet("created", "edited", "deleted")},
+	"pull_request_target":         {types: pullRequestTypes, keys: pullRequestKeys},
+	"push":                        {keys: keySet("branches", "branches-ignore", "tags", "tags-ignore", "paths", "paths-ignore")},
+	"registry_package":            {types: keySet("published", "updated")},
+	"release":                     {types: keySet("published", "unpublished", "created", "edited", "deleted", "prereleased", "released")},
+	// repository_dispatch types are chosen by the sender.
+	"repository_dispatch": {types: keySet()},
+	"schedule":            {},
+	"status":              {},
+	"watch":               {types: keySet("started")},
+	"workflow_call":       {keys: keySet("inputs", "outputs", "secrets")},
+	"workflow_dispatch":   {keys: keySet("inputs")},
+	"workflow_run":        {types: keySet("completed", "requested"), keys: keySet("workflows", "branches", "branches-ignore")},
+}
+
+func keySet(keys ...string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
@@ -0,0 +1,381 @@
+package workflow
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rules reported by Validate.
+const (
+	// RuleSchema flags unknown keys and values of the wrong kind. GitHub
+	// ignores some of these, like "type" for "types", silently.
+	RuleSchema = "schema"
+	// RuleActivityType flags unknown activity types.
+	RuleActivityType = "activity-type"
+	// RuleCron flags invalid cron expressions.
+	RuleCron = "cron"
+	// RuleSchedule flags schedules GitHub will not run as written.
+	RuleSchedule = "schedule"
+	// RuleComment flags comments describing a schedule other than the
+	// one configured.
+	RuleComment = "comment"
+)
+
+// minInterval is the shortest interval GitHub runs schedules at.
+const minInterval = 5 * time.Minute
+
+// Validate checks the structure of a workflow against the workflow syntax,
+// and that its schedules parse and match their comments.
+func Validate(f *File) []Problem {
+	var problems []Problem
+	problems = append(problems, f.checkKeys(f.Root, workflowKeys, "workflow")...)
+	problems = append(problems, f.validateTriggers()...)
+	if _, perms := lookup(f.Root, "permissions"); perms != nil {
+		problems = append(problems, f.validatePermissions(perms)...)
+	}
+	_, jobs := lookup(f.Root, "jobs")
+	switch {
+	case jobs == nil:
+		problems = append(problems, f.problem(f.Root, RuleSchema, "workflow has no jobs"))
+	case jobs.Kind != yaml.MappingNode:
+		problems = append(problems, f.problem(jobs, RuleSchema, "jobs must be a mapping of job IDs to jobs"))
+	}
+	for _, job := range f.Jobs() {
+		problems = append(problems, f.validateJob(job)...)
+	}
+	return problems
+}
+
+// checkKeys reports keys of mapping m not in allowed.
+func (f *File) checkKeys(m *yaml.Node, allowed map[string]bool, what string) []Problem {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	var problems []Problem
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key := m.Content[i]
+		if allowed[key.Value] {
+			continue
+		}
+		msg := fmt.Sprintf("unknown %v key %q", what, key.Value)
+		if s := suggest(key.Value, allowed); s != "" {
+			msg += fmt.Sprintf(", did you mean %q?", s)
+		}
+		problems = append(problems, f.problem(key, RuleSchema, "%v", msg))
+	}
+	return problems
+}
+
+// suggest returns the allowed key closest to key, if any is close.
+func suggest(key string, allowed map[string]bool) string {
+	var keys []string
+	for k := range allowed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	best, bestDist := "", 3
+	for _, k := range keys {
+		if d := distance(key, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
+
+// validateTriggers checks the events under "on" and their filters.
+func (f *File) validateTriggers() []Problem {
+	key, on := lookup(f.Root, "on")
+	if on == nil {
+		return []Problem{f.problem(f.Root, RuleSchema, "workflow has no \"on\" triggers")}
+	}
+	var problems []Problem
+	var names []*yaml.Node
+	switch on.Kind {
+	case yaml.ScalarNode:
+		names = []*yaml.Node{on}
+	case yaml.SequenceNode:
+		names = on.Content
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(on.Content); i += 2 {
+			names = append(names, on.Content[i])
+		}
+	default:
+		return []Problem{f.problem(key, RuleSchema, "\"on\" must be an event, a list of events or a mapping")}
+	}
+	triggers := f.Triggers()
+	for _, name := range names {
+		e, ok := events[name.Value]
+		if !ok {
+			msg := fmt.Sprintf("unknown event %q", name.Value)
+			all := make(map[string]bool, len(events))
+			for k := range events {
+				all[k] = true
+			}
+			if s := suggest(name.Value, all); s != "" {
+				msg += fmt.Sprintf(", did you mean %q?", s)
+			}
+			problems = append(problems, f.problem(name, RuleSchema, "%v", msg))
+			continue
+		}
+		config := triggers[name.Value]
+		if name.Value == "schedule" {
+			problems = append(problems, f.validateSchedule(name, config)...)
+			continue
+		}
+		problems = append(problems, f.validateEvent(name.Value, e, config)...)
+	}
+	return problems
+}
+
+// validateEvent checks the configuration of a trigger.
+func (f *File) validateEvent(name string, e event, config *yaml.Node) []Problem {
+	if config == nil || config.Tag == "!!null" {
+		return nil
+	}
+	if config.Kind != yaml.MappingNode {
+		return []Problem{f.problem(config, RuleSchema, "%v must be a mapping of filters", name)}
+	}
+	allowed := map[string]bool{}
+	for k := range e.keys {
+		allowed[k] = true
+	}
+	if e.types != nil {
+		allowed["types"] = true
+	}
+	problems := f.checkKeys(config, allowed, name)
+	if _, types := lookup(config, "types"); types != nil && len(e.types) > 0 {
+		for _, t := range scalars(types) {
+			if !e.types[t.Value] {
+				problems = append(problems, f.problem(t, RuleActivityType, "%v has no activity type %q", name, t.Value))
+			}
+		}
+	}
+	for _, filter := range []string{"branches", "tags", "paths"} {
+		k, _ := lookup(config, filter)
+		if ignore, _ := lookup(config, filter+"-ignore"); k != nil && ignore != nil {
+			problems = append(problems, f.problem(ignore, RuleSchema, "%v cannot use both %v and %v-ignore", name, filter, filter))
+		}
+	}
+	return problems
+}
+
+// scalars returns n if it is a scalar, or the scalars in sequence n.
+func scalars(n *yaml.Node) []*yaml.Node {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return []*yaml.Node{n}
+	case yaml.SequenceNode:
+		var out []*yaml.Node
+		for _, c := range n.Content {
+			if c.Kind == yaml.ScalarNode {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// validateSchedule checks the cron expressions of a schedule trigger.
+func (f *File) validateSchedule(key, schedule *yaml.Node) []Problem {
+	if schedule == nil || schedule.Kind != yaml.SequenceNode {
+		return []Problem{f.problem(key, RuleSchema, "schedule must be a list of cron entries")}
+	}
+	var problems []Problem
+	for _, entry := range schedule.Content {
+		problems = append(problems, f.checkKeys(entry, keySet("cron"), "schedule")...)
+		cronKey, spec := lookup(entry, "cron")
+		if spec == nil {
+			problems = append(problems, f.problem(entry, RuleSchema, "schedule entry has no cron"))
+			continue
+		}
+		c, err := ParseCron(spec.Value)
+		if err != nil {
+			problems = append(problems, f.problem(spec, RuleCron, "%v", err))
+			continue
+		}
+		// Judge intervals from a fixed time, so results do not depend on
+		// the day validation runs.
+		from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		if c.Next(from).IsZero() {
+			problems = append(problems, f.problem(spec, RuleCron, "cron %q never runs", spec.Value))
+			continue
+		}
+		if d := c.MinInterval(from); d != 0 && d < minInterval {
+			problems = append(problems, f.problem(spec, RuleSchedule,
+				"cron %q runs %v, GitHub runs schedules at most every 5 minutes", spec.Value, describeInterval(d)))
+		}
+		if p, ok := f.checkComment([]*yaml.Node{key, schedule, entry, cronKey, spec}, c, spec, from); !ok {
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+// interval matches intervals described in comments, as in "every 5
+// minutes" or "hourly".
+var interval = regexp.MustCompile(`(?i)\bevery\s+(\d+|an?|one)?\s*(minute|hour|day|week)s?\b|\b(hourly|daily|weekly)\b`)
+
+// checkComment checks the first comment on nodes describing an interval
+// against the schedule's. It returns false and a problem if they differ.
+func (f *File) checkComment(nodes []*yaml.Node, c *Cron, spec *yaml.Node, from time.Time) (Problem, bool) {
+	for _, n := range nodes {
+		for _, comment := range []string{n.HeadComment, n.LineComment} {
+			m := interval.FindStringSubmatch(comment)
+			if m == nil {
+				continue
+			}
+			got := c.Interval(from)
+			if got == commentInterval(m) {
+				return Problem{}, true
+			}
+			actual := "at irregular intervals"
+			if got != 0 {
+				actual = describeInterval(got)
+			}
+			return f.problem(spec, RuleComment, "comment says %q but cron %q runs %v",
+				strings.TrimSpace(m[0]), spec.Value, actual), false
+		}
+	}
+	return Problem{}, true
+}
+
+// commentInterval returns the interval matched by the interval regexp.
+func commentInterval(m []string) time.Duration {
+	units := map[string]time.Duration{
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+		"hourly": time.Hour,
+		"daily":  24 * time.Hour,
+		"weekly": 7 * 24 * time.Hour,
+	}
+	if m[3] != "" {
+		return units[strings.ToLower(m[3])]
+	}
+	n := 1
+	if v, err := strconv.Atoi(m[1]); err == nil {
+		n = v
+	}
+	return time.Duration(n) * units[strings.ToLower(m[2])]
+}
+
+// validatePermissions checks permission scopes and levels.
+func (f *File) validatePermissions(perms *yaml.Node) []Problem {
+	switch perms.Kind {
+	case yaml.ScalarNode:
+		switch perms.Value {
+		case "read-all", "write-all":
+			return nil
+		}
+		return []Problem{f.problem(perms, RuleSchema, "permissions must be read-all, write-all or a mapping of scopes, not %q", perms.Value)}
+	case yaml.MappingNode:
+		problems := f.checkKeys(perms, permissionScopes, "permission")
+		for i := 0; i+1 < len(perms.Content); i += 2 {
+			level := perms.Content[i+1]
+			if _, ok := levels[level.Value]; !ok {
+				problems = append(problems, f.problem(level, RuleSchema,
+					"%v: level must be read, write or none, not %q", perms.Content[i].Value, level.Value))
+			}
+		}
+		return problems
+	}
+	return []Problem{f.problem(perms, RuleSchema, "permissions must be read-all, write-all or a mapping of scopes")}
+}
+
+// validateJob checks a job and its steps.
+func (f *File) validateJob(job Job) []Problem {
+	if job.Node.Kind != yaml.MappingNode {
+		return []Problem{f.problem(job.Key, RuleSchema, "job %q must be a mapping", job.ID)}
+	}
+	problems := f.checkKeys(job.Node, jobKeys, "job")
+	if _, perms := lookup(job.Node, "permissions"); perms != nil {
+		problems = append(problems, f.validatePermissions(perms)...)
+	}
+	runsOn, _ := lookup(job.Node, "runs-on")
+	uses, _ := lookup(job.Node, "uses")
+	switch {
+	case runsOn == nil && uses == nil:
+		problems = append(problems, f.problem(job.Key, RuleSchema, "job %q needs runs-on, or uses to call a workflow", job.ID))
+	case uses == nil:
+		if k, _ := lookup(job.Node, "steps"); k == nil {
+			problems = append(problems, f.problem(job.Key, RuleSchema, "job %q has no steps", job.ID))
+		}
+	}
+	for _, step := range job.Steps() {
+		problems = append(problems, f.checkKeys(step, stepKeys, "step")...)
+		run, _ := lookup(step, "run")
+		uses, _ := lookup(step, "uses")
+		switch {
+		case run == nil && uses == nil:
+			problems = append(problems, f.problem(step, RuleSchema, "step needs run or uses"))
+		case run != nil && uses != nil:
+			problems = append(problems, f.problem(uses, RuleSchema, "step cannot have both run and uses"))
+		}
+	}
+	return problems
+}
+
+// Schedule is a cron schedule of a workflow.
+type Schedule struct {
+	// Node is the cron expression's node.
+	Node *yaml.Node
+	Cron *Cron
+}
+
+// Schedules returns the workflow's valid cron schedules.
+func (f *File) Schedules() []Schedule {
+	var schedules []Schedule
+	schedule := f.Triggers()["schedule"]
+	if schedule == nil || schedule.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, entry := range schedule.Content {
+		_, spec := lookup(entry, "cron")
+		if spec == nil {
+			continue
+		}
+		if c, err := ParseCron(spec.Value); err == nil {
+			schedules = append(schedules, Schedule{Node: spec, Cron: c})
+		}
+	}
+	return schedules
+}
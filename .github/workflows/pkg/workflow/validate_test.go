@@ -0,0 +1,144 @@
+package workflow
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	// job is a valid job for the workflows below.
+	const job = "jobs:\n  job:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n"
+	tests := []struct {
+		desc string
+		data string
+		want []string
+	}{
+		{
+			desc: "valid",
+			data: "on:\n  pull_request_target:\n    types: [opened, synchronize]\n    branches: [master]\npermissions:\n  contents: none\n" + job,
+		},
+		{
+			desc: "type for types",
+			data: "on:\n  pull_request_target:\n    type: [opened]\n" + job,
+			want: []string{`wf.yml:3:5: schema: unknown pull_request_target key "type", did you mean "types"?`},
+		},
+		{
+			desc: "unknown activity type",
+			data: "on:\n  pull_request_review:\n    types: [submitted, approved]\n" + job,
+			want: []string{`wf.yml:3:24: activity-type: pull_request_review has no activity type "approved"`},
+		},
+		{
+			desc: "unknown event",
+			data: "on: [push, pull_requests]\n" + job,
+			want: []string{`wf.yml:1:12: schema: unknown event "pull_requests", did you mean "pull_request"?`},
+		},
+		{
+			desc: "filter and its ignore",
+			data: "on:\n  push:\n    branches: [master]\n    branches-ignore: [dev]\n" + job,
+			want: []string{"wf.yml:4:5: schema: push cannot use both branches and branches-ignore"},
+		},
+		{
+			desc: "unknown workflow, job and step keys",
+			data: "on: push\npermission:\n  contents: read\njobs:\n  job:\n    runs_on: ubuntu-latest\n    steps:\n      - run: make\n        working-dir: lib\n",
+			want: []string{
+				`wf.yml:2:1: schema: unknown workflow key "permission", did you mean "permissions"?`,
+				`wf.yml:6:5: schema: unknown job key "runs_on", did you mean "runs-on"?`,
+				`wf.yml:5:3: schema: job "job" needs runs-on, or uses to call a workflow`,
+				`wf.yml:9:9: schema: unknown step key "working-dir"`,
+			},
+		},
+		{
+			desc: "permission levels",
+			data: "on: push\npermissions:\n  contents: admin\n  pull_request: write\n" + job,
+			want: []string{
+				`wf.yml:4:3: schema: unknown permission key "pull_request", did you mean "pull-requests"?`,
+				`wf.yml:3:13: schema: contents: level must be read, write or none, not "admin"`,
+			},
+		},
+		{
+			desc: "step with run and uses",
+			data: "on: push\njobs:\n  job:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n        uses: actions/checkout@v2\n      - name: nothing\n",
+			want: []string{
+				"wf.yml:7:9: schema: step cannot have both run and uses",
+				"wf.yml:8:9: schema: step needs run or uses",
+			},
+		},
+		{
+			desc: "no jobs",
+			data: "on: push\n",
+			want: []string{"wf.yml:1:1: schema: workflow has no jobs"},
+		},
+		{
+			desc: "invalid cron",
+			data: "on:\n  schedule:\n    - cron: '0 25 * * *'\n" + job,
+			want: []string{`wf.yml:3:13: cron: cron "0 25 * * *": hour: 25 is out of range 0-23`},
+		},
+		{
+			desc: "cron that never runs",
+			data: "on:\n  schedule:\n    - cron: '0 0 30 2 *'\n" + job,
+			want: []string{`wf.yml:3:13: cron: cron "0 0 30 2 *" never runs`},
+		},
+		{
+			desc: "every minute",
+			data: "on:\n  schedule:\n    - cron: '* * * * *'\n" + job,
+			want: []string{`wf.yml:3:13: schedule: cron "* * * * *" runs every minute, GitHub runs schedules at most every 5 minutes`},
+		},
+		{
+			desc: "minutes apart",
+			data: "on:\n  schedule:\n    - cron: '0,2 * * * *'\n" + job,
+			want: []string{`wf.yml:3:13: schedule: cron "0,2 * * * *" runs every 2 minutes, GitHub runs schedules at most every 5 minutes`},
+		},
+		{
+			desc: "comment matching the schedule",
+			data: "on:\n  # Every 15 minutes.\n  schedule:\n    - cron: '*/15 * * * *'\n" + job,
+		},
+		{
+			desc: "line comment matching the schedule",
+			data: "on:\n  schedule:\n    - cron: '0 3 * * *' # daily\n" + job,
+		},
+		{
+			desc: "comment not matching the schedule",
+			data: "on:\n  schedule:\n    # Run every hour.\n    - cron: '*/30 * * * *'\n" + job,
+			want: []string{`wf.yml:4:13: comment: comment says "every hour" but cron "*/30 * * * *" runs every 30 minutes`},
+		},
+		{
+			desc: "comment on an irregular schedule",
+			data: "on:\n  schedule:\n    - cron: '0 9,17 * * *' # Every day.\n" + job,
+			want: []string{`wf.yml:3:13: comment: comment says "Every day" but cron "0 9,17 * * *" runs at irregular intervals`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			f, err := Parse("wf.yml", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range Validate(f) {
+				got = append(got, p.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got problems %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestSchema validates the repository's own workflows, which use most of
+// the syntax the schema describes.
+func TestSchema(t *testing.T) {
+	files, err := LoadDir("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("found no workflows")
+	}
+	for _, f := range files {
+		for _, p := range Validate(f) {
+			t.Errorf("%v", p)
+		}
+	}
+}
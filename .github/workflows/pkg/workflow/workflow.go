@@ -0,0 +1,179 @@
+// Package workflow parses GitHub Actions workflow files, keeping the YAML
+// node tree so that problems can be reported with their line and column.
+package workflow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a parsed workflow file.
+type File struct {
+	// Path is the path the file was read from.
+	Path string
+	// Root is the top-level mapping of the workflow.
+	Root *yaml.Node
+
+	// lines are the source lines, to locate problems inside scalars.
+	lines []string
+}
+
+// Problem is an issue found in a workflow file.
+type Problem struct {
+	Path   string
+	Line   int
+	Column int
+	// Rule identifies the check that found the problem.
+	Rule    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%v:%v:%v: %v: %v", p.Path, p.Line, p.Column, p.Rule, p.Message)
+}
+
+// problem returns a problem located at n.
+func (f *File) problem(n *yaml.Node, rule, format string, args ...interface{}) Problem {
+	return Problem{
+		Path:    f.Path,
+		Line:    n.Line,
+		Column:  n.Column,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Load parses the workflow file at path.
+func Load(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse parses a workflow read from path.
+func Parse(path string, data []byte) (*File, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%v: workflow is not a mapping", path)
+	}
+	return &File{
+		Path:  path,
+		Root:  doc.Content[0],
+		lines: strings.Split(string(data), "\n"),
+	}, nil
+}
+
+// LoadDir parses the workflow files, ending in .yml or .yaml, in dir.
+func LoadDir(dir string) ([]*File, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	var files []*File
+	for _, path := range paths {
+		f, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Triggers returns the events the workflow runs on, mapped to their
+// configuration node, which is nil if the event has none.
+func (f *File) Triggers() map[string]*yaml.Node {
+	triggers := map[string]*yaml.Node{}
+	_, on := lookup(f.Root, "on")
+	if on == nil {
+		return triggers
+	}
+	switch on.Kind {
+	case yaml.ScalarNode:
+		triggers[on.Value] = nil
+	case yaml.SequenceNode:
+		for _, n := range on.Content {
+			triggers[n.Value] = nil
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(on.Content); i += 2 {
+			triggers[on.Content[i].Value] = on.Content[i+1]
+		}
+	}
+	return triggers
+}
+
+// Job is a job of a workflow.
+type Job struct {
+	// ID is the job's key.
+	ID string
+	// Key is the node of the job's key.
+	Key *yaml.Node
+	// Node is the job's mapping.
+	Node *yaml.Node
+}
+
+// Jobs returns the workflow's jobs in file order.
+func (f *File) Jobs() []Job {
+	_, jobs := lookup(f.Root, "jobs")
+	if jobs == nil || jobs.Kind != yaml.MappingNode {
+		return nil
+	}
+	var out []Job
+	for i := 0; i+1 < len(jobs.Content); i += 2 {
+		out = append(out, Job{ID: jobs.Content[i].Value, Key: jobs.Content[i], Node: jobs.Content[i+1]})
+	}
+	return out
+}
+
+// Steps returns the mappings of the job's steps.
+func (j Job) Steps() []*yaml.Node {
+	_, steps := lookup(j.Node, "steps")
+	if steps == nil || steps.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var out []*yaml.Node
+	for _, s := range steps.Content {
+		if s.Kind == yaml.MappingNode {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// lookup returns the key and value nodes of key in mapping m, or nils.
+func lookup(m *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// value returns the scalar value of key in mapping m, or "".
+func value(m *yaml.Node, key string) string {
+	_, v := lookup(m, key)
+	if v == nil || v.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return v.Value
+}